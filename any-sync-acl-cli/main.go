@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/anyproto/any-sync-tools/anyconf/nodelist"
 	"github.com/anyproto/any-sync/accountservice"
 	"github.com/anyproto/any-sync/app"
 	"github.com/anyproto/any-sync/app/logger"
@@ -30,7 +31,6 @@ import (
 	"github.com/anyproto/any-sync/nodeconf/nodeconfstore"
 	"github.com/anyproto/any-sync/testutil/accounttest"
 	"github.com/anyproto/any-sync/util/crypto"
-	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -55,16 +55,11 @@ func main() {
 		log.Fatal("network config file not specified")
 	}
 
-	data, err := os.ReadFile(*fNetwork)
+	netConf, _, err := nodelist.Load(*fNetwork)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var netConf nodeconf.Configuration
-	if err = yaml.Unmarshal(data, &netConf); err != nil {
-		log.Fatal(err)
-	}
-
 	cli, err := newApp(&Config{Network: netConf}, ctx)
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anyproto/any-sync/app"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// metrics are the results of the probes of -interval mode, labeled by address and transport
+type metrics struct {
+	stageDuration *prometheus.HistogramVec
+	probes        *prometheus.CounterVec
+	failures      *prometheus.CounterVec
+	success       *prometheus.GaugeVec
+	lastSuccess   *prometheus.GaugeVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "netcheck",
+			Name:      "stage_duration_seconds",
+			Help:      "Duration of the probe stages, the request stages are labeled by node type",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"peer_id", "addr", "transport", "stage", "type"}),
+		probes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "netcheck",
+			Name:      "probes_total",
+			Help:      "Probes of the address by result",
+		}, []string{"peer_id", "addr", "transport", "result"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "netcheck",
+			Name:      "probe_failures_total",
+			Help:      "Failed probes of the address by the stage and the class of the error",
+		}, []string{"peer_id", "addr", "transport", "stage", "class"}),
+		success: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "netcheck",
+			Name:      "probe_success",
+			Help:      "Whether the last probe of the address succeeded",
+		}, []string{"peer_id", "addr", "transport"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "netcheck",
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix time of the last successful probe of the address",
+		}, []string{"peer_id", "addr", "transport"}),
+	}
+	reg.MustRegister(m.stageDuration, m.probes, m.failures, m.success, m.lastSuccess)
+	return m
+}
+
+// init creates the series of the addresses, so the counters start at zero before the first failure
+func (m *metrics) init(targets []target) {
+	for _, t := range targets {
+		for _, addr := range t.Addrs {
+			m.probes.WithLabelValues(t.PeerId, addr, transportOf(addr), "success")
+			m.probes.WithLabelValues(t.PeerId, addr, transportOf(addr), "failure")
+		}
+	}
+}
+
+func (m *metrics) observe(res probeResult, now time.Time) {
+	transport := transportOf(res.Addr)
+	for _, s := range res.Stages {
+		m.stageDuration.WithLabelValues(res.PeerId, res.Addr, transport, s.Stage, string(s.Type)).Observe(s.Dur.Seconds())
+	}
+	failure, failed := res.failure()
+	if failed {
+		m.probes.WithLabelValues(res.PeerId, res.Addr, transport, "failure").Inc()
+		m.failures.WithLabelValues(res.PeerId, res.Addr, transport, failure.Stage, classifyError(failure.Err)).Inc()
+		m.success.WithLabelValues(res.PeerId, res.Addr, transport).Set(0)
+		return
+	}
+	m.probes.WithLabelValues(res.PeerId, res.Addr, transport, "success").Inc()
+	m.success.WithLabelValues(res.PeerId, res.Addr, transport).Set(1)
+	m.lastSuccess.WithLabelValues(res.PeerId, res.Addr, transport).Set(float64(now.Unix()))
+}
+
+func transportOf(addr string) string {
+	if scheme, _, found := strings.Cut(addr, "://"); found {
+		return scheme
+	}
+	return ""
+}
+
+// monitor probes the targets every -interval until ctx is done and serves the metrics on -metrics-addr.
+// Every round has its own -deadline
+func monitor(ctx context.Context, a *app.App, targets []target) error {
+	reg := prometheus.NewRegistry()
+	m := newMetrics(reg)
+	m.init(targets)
+
+	lis, err := net.Listen("tcp", *metricsAddr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("metrics server error", zap.Error(err))
+		}
+	}()
+	defer srv.Close()
+	log.Info("serving metrics", zap.String("addr", lis.Addr().String()), zap.Duration("interval", *interval))
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		round(ctx, a, targets, m)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func round(ctx context.Context, a *app.App, targets []target, m *metrics) {
+	st := time.Now()
+	roundCtx, cancel := context.WithTimeout(ctx, *deadline)
+	defer cancel()
+	results := probeAll(roundCtx, a, targets)
+	if ctx.Err() != nil {
+		// the probes cut by the shutdown are no failures of the nodes
+		return
+	}
+
+	now := time.Now()
+	failed := 0
+	for _, res := range results {
+		m.observe(res, now)
+		if _, ok := res.failure(); ok {
+			failed++
+		}
+	}
+	if *format == "json" {
+		printJson(os.Stdout, results)
+	}
+	log.Info("round finished", zap.Int("addrs", len(results)), zap.Int("failed", failed), zap.Duration("dur", time.Since(st)))
+}
@@ -3,42 +3,25 @@ package main
 import (
 	"context"
 	"flag"
+	"github.com/anyproto/any-sync-tools/anyconf/nodelist"
 	"github.com/anyproto/any-sync/app"
 	"github.com/anyproto/any-sync/app/logger"
-	"github.com/anyproto/any-sync/coordinator/coordinatorproto"
-	"github.com/anyproto/any-sync/net/connutil"
 	"github.com/anyproto/any-sync/net/secureservice"
-	"github.com/anyproto/any-sync/net/secureservice/handshake"
-	"github.com/anyproto/any-sync/net/secureservice/handshake/handshakeproto"
 	"github.com/anyproto/any-sync/net/transport"
 	"github.com/anyproto/any-sync/net/transport/quic"
 	"github.com/anyproto/any-sync/net/transport/yamux"
 	"github.com/anyproto/any-sync/nodeconf"
 	"github.com/anyproto/any-sync/testutil/accounttest"
 	"github.com/anyproto/go-chash"
-	yamux2 "github.com/hashicorp/yamux"
 	"github.com/matishsiao/goInfo"
 	"go.uber.org/zap"
-	"net"
-	"storj.io/drpc/drpcconn"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
-	"os"
-	"gopkg.in/yaml.v3"
 )
 
-type ConfigFile struct {
-	Id        string `yaml:"id"`
-	NetworkId string `yaml:"networkId"`
-	Nodes     []Node `yaml:"nodes"`
-}
-
-type Node struct {
-	Addresses []string `yaml:"addresses"`
-	PeerId    string   `yaml:"peerId"`
-	Types     []string `yaml:"types"`
-}
-
 var ctx = context.Background()
 
 var log = logger.NewNamed("netcheck")
@@ -57,49 +40,51 @@ var (
 	verbose   = flag.Bool("v", false, "verbose logs")
 	addrs     = flag.String("addrs", defaultAddrs, "comma separated list of addrs")
 	clientYml = flag.String("c", "", "path to client.yml file")
+	format    = flag.String("format", "text", "output format: text or json, one object per address")
+
+	parallel         = flag.Int("parallel", 8, "max number of addresses probed at once")
+	dialTimeout      = flag.Duration("dial-timeout", 10*time.Second, "timeout of the TCP dial, for QUIC the dial performs the handshakes and is limited by -dial-timeout plus -handshake-timeout")
+	handshakeTimeout = flag.Duration("handshake-timeout", 10*time.Second, "timeout of the TLS and any-sync handshakes, for QUIC it can't be set apart from -dial-timeout, their sum limits the dial")
+	requestTimeout   = flag.Duration("request-timeout", 10*time.Second, "timeout of the request of each node type")
+	deadline         = flag.Duration("deadline", 2*time.Minute, "deadline of the whole run, the probes not finished by then fail")
+
+	interval    = flag.Duration("interval", 0, "re-probe every interval and serve the metrics instead of a one-shot check")
+	metricsAddr = flag.String("metrics-addr", ":9188", "listen address of the Prometheus metrics of -interval mode")
 )
 
 func main() {
 	flag.Parse()
+	if *parallel < 1 {
+		*parallel = 1
+	}
+	if *format != "text" && *format != "json" {
+		log.Fatal("unexpected format", zap.String("format", *format))
+	}
 
 	logger.SetNamedLevels(logger.LevelsFromStr("*=INFO"))
 	if *verbose {
 		logger.SetNamedLevels(logger.LevelsFromStr("*=DEBUG"))
 	}
 
-	var checkAddrs []string
+	var targets []target
 	if *clientYml != "" {
-		file, err := os.ReadFile(*clientYml)
+		nodesConfig, _, err := nodelist.Load(*clientYml)
 		if err != nil {
 			log.Fatal("cannot read client.yml", zap.Error(err))
 		}
-
-		var configFile ConfigFile
-		if err := yaml.Unmarshal(file, &configFile); err != nil {
-			log.Fatal("cannot unmarshal client.yml", zap.Error(err))
-		}
-
-		for _, node := range configFile.Nodes {
-			for _, t := range node.Types {
-				if t == "coordinator" {
-					for _, address := range node.Addresses {
-						if !strings.HasPrefix(address, "quic://") {
-							address = "yamux://" + address
-						}
-						checkAddrs = append(checkAddrs, address)
-					}
-				}
-			}
-		}
+		targets = nodeTargets(nodesConfig)
 	} else {
-		checkAddrs = strings.Split(*addrs, ",")
+		targets = addrTargets(strings.Split(*addrs, ","))
 	}
 
-	info, err := goInfo.GetInfo()
-	if err != nil {
-		log.Warn("can't get system info", zap.Error(err))
-	} else {
-		info.VarDump()
+	// the system info is for the text report, json consumers and the monitor get the results only
+	if *format == "text" && *interval <= 0 {
+		info, err := goInfo.GetInfo()
+		if err != nil {
+			log.Warn("can't get system info", zap.Error(err))
+		} else {
+			info.VarDump()
+		}
 	}
 
 	a := new(app.App)
@@ -108,141 +93,32 @@ func main() {
 		panic(err)
 	}
 
-	for _, addr := range checkAddrs {
-		addr = strings.TrimSpace(addr)
-		switch {
-		case strings.HasPrefix(addr, "yamux://"):
-			probeYamux(a, addr[8:])
-		case strings.HasPrefix(addr, "quic://"):
-			probeQuic(a, addr[7:])
-		default:
-			log.Warn("unexpected address scheme", zap.String("addr", addr))
+	if *interval > 0 {
+		sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := monitor(sigCtx, a, targets); err != nil {
+			log.Fatal("monitor error", zap.Error(err))
 		}
-	}
-}
-
-
-func probeYamux(a *app.App, addr string) {
-	ss := a.MustComponent(secureservice.CName).(secureservice.SecureService)
-	l := log.With(zap.String("addr", addr))
-
-	l.Debug("open TCP conn")
-	st := time.Now()
-	conn, err := net.DialTimeout("tcp", addr, time.Second*60)
-	if err != nil {
-		l.Warn("open TCP conn error", zap.Error(err), zap.Duration("dur", time.Since(st)))
-		return
-	} else {
-		l.Debug("TCP conn established", zap.Duration("dur", time.Since(st)))
-		l = l.With(zap.String("ip", conn.RemoteAddr().String()))
-	}
-	defer conn.Close()
-
-	l.Debug("start handshake")
-	hst := time.Now()
-	cctx, err := ss.SecureOutbound(ctx, conn)
-	if err != nil {
-		l.Warn("handshake error", zap.Error(err), zap.Duration("dur", time.Since(hst)))
-		return
-	} else {
-		l.Debug("handshake success", zap.Duration("dur", time.Since(hst)), zap.Duration("total", time.Since(st)))
-	}
-
-	yst := time.Now()
-	l.Debug("open yamux session")
-	sess, err := yamux2.Client(conn, yamux2.DefaultConfig())
-	if err != nil {
-		l.Warn("yamux session error", zap.Error(err), zap.Duration("dur", time.Since(yst)))
 		return
-	} else {
-		l.Debug("yamux session success", zap.Duration("dur", time.Since(yst)), zap.Duration("total", time.Since(st)))
-	}
-
-	mc := yamux.NewMultiConn(cctx, connutil.NewLastUsageConn(conn), conn.RemoteAddr().String(), sess)
-	l.Debug("open sub connection")
-	scst := time.Now()
-	sc, err := mc.Open(ctx)
-	if err != nil {
-		l.Warn("open sub connection error", zap.Error(err), zap.Duration("dur", time.Since(scst)))
-		return
-	} else {
-		l.Debug("open sub conn success", zap.Duration("dur", time.Since(scst)), zap.Duration("total", time.Since(st)))
-		defer sc.Close()
-	}
-
-	l.Debug("start proto handshake")
-	phst := time.Now()
-	if _, err = handshake.OutgoingProtoHandshake(ctx, sc, &handshakeproto.Proto{
-		Proto:     handshakeproto.ProtoType_DRPC,
-		Encodings: []handshakeproto.Encoding{handshakeproto.Encoding_None},
-	}); err != nil {
-		l.Warn("proto handshake error", zap.Duration("dur", time.Since(phst)), zap.Error(err))
-		return
-	} else {
-		l.Debug("proto handshake success", zap.Duration("dur", time.Since(phst)), zap.Duration("total", time.Since(st)))
-	}
-
-	l.Debug("start configuration request")
-	rst := time.Now()
-	resp, err := coordinatorproto.NewDRPCCoordinatorClient(drpcconn.New(sc)).NetworkConfiguration(ctx, &coordinatorproto.NetworkConfigurationRequest{})
-	if err != nil {
-		l.Warn("configuration request error", zap.Error(err), zap.Duration("dur", time.Since(rst)))
-		return
-	} else {
-		l.Debug("configuration request success", zap.Duration("dur", time.Since(rst)), zap.Duration("total", time.Since(st)), zap.String("nid", resp.GetNetworkId()))
-	}
-	l.Info("success", zap.Duration("dur", time.Since(st)))
-}
-
-func probeQuic(a *app.App, addr string) {
-	qs := a.MustComponent(quic.CName).(quic.Quic)
-	l := log.With(zap.String("addr", addr))
-
-	l.Debug("open QUIC conn")
-	st := time.Now()
-	mc, err := qs.Dial(ctx, addr)
-	if err != nil {
-		l.Warn("open QUIC conn error", zap.Error(err), zap.Duration("dur", time.Since(st)))
-		return
-	} else {
-		l.Debug("QUIC conn established", zap.Duration("dur", time.Since(st)))
-		l = l.With(zap.String("ip", mc.Addr()))
-	}
-	defer mc.Close()
-
-	l.Debug("open sub connection")
-	scst := time.Now()
-	sc, err := mc.Open(ctx)
-	if err != nil {
-		l.Warn("open sub connection error", zap.Error(err), zap.Duration("dur", time.Since(scst)))
-		return
-	} else {
-		l.Debug("open sub conn success", zap.Duration("dur", time.Since(scst)), zap.Duration("total", time.Since(st)))
-		defer sc.Close()
 	}
 
-	l.Debug("start proto handshake")
-	phst := time.Now()
-	if _, err = handshake.OutgoingProtoHandshake(ctx, sc, &handshakeproto.Proto{
-		Proto:     handshakeproto.ProtoType_DRPC,
-		Encodings: []handshakeproto.Encoding{handshakeproto.Encoding_None},
-	}); err != nil {
-		l.Warn("proto handshake error", zap.Duration("dur", time.Since(phst)), zap.Error(err))
-		return
+	runCtx, cancel := context.WithTimeout(ctx, *deadline)
+	defer cancel()
+	results := probeAll(runCtx, a, targets)
+	reports := peerReports(targets, results)
+	ok := true
+	if *format == "json" {
+		printJson(os.Stdout, results)
+		for _, p := range reports {
+			ok = ok && p.ok()
+		}
 	} else {
-		l.Debug("proto handshake success", zap.Duration("dur", time.Since(phst)), zap.Duration("total", time.Since(st)))
+		ok = printReport(reports)
 	}
-
-	l.Debug("start configuration request")
-	rst := time.Now()
-	resp, err := coordinatorproto.NewDRPCCoordinatorClient(drpcconn.New(sc)).NetworkConfiguration(ctx, &coordinatorproto.NetworkConfigurationRequest{})
-	if err != nil {
-		l.Warn("configuration request error", zap.Error(err), zap.Duration("dur", time.Since(rst)))
-		return
-	} else {
-		l.Debug("configuration request success", zap.Duration("dur", time.Since(rst)), zap.Duration("total", time.Since(st)), zap.String("nid", resp.GetNetworkId()))
+	if !ok {
+		cancel()
+		os.Exit(1)
 	}
-	l.Info("success", zap.Duration("dur", time.Since(st)))
 }
 
 func bootstrap(a *app.App) {
@@ -263,20 +139,26 @@ func (c config) Init(a *app.App) error { return nil }
 
 func (c config) GetYamux() yamux.Config {
 	return yamux.Config{
-		WriteTimeoutSec:    60,
-		DialTimeoutSec:     60,
+		WriteTimeoutSec:    timeoutSec(*requestTimeout),
+		DialTimeoutSec:     timeoutSec(*dialTimeout),
 		KeepAlivePeriodSec: 120,
 	}
 }
 
+// GetQuic sets the dial timeout to cover the handshakes, as the QUIC dial performs them
 func (c config) GetQuic() quic.Config {
 	return quic.Config{
-		WriteTimeoutSec:    60,
-		DialTimeoutSec:     60,
+		WriteTimeoutSec:    timeoutSec(*requestTimeout),
+		DialTimeoutSec:     timeoutSec(*dialTimeout + *handshakeTimeout),
 		KeepAlivePeriodSec: 120,
 	}
 }
 
+// timeoutSec rounds the timeout up to whole seconds of the transport configs
+func timeoutSec(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
 type nodeConf struct {
 }
 
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anyproto/any-sync/app"
+	"github.com/anyproto/any-sync/app/logger"
+	"github.com/anyproto/any-sync/commonfile/fileproto"
+	"github.com/anyproto/any-sync/commonspace/spacesyncproto"
+	"github.com/anyproto/any-sync/coordinator/coordinatorproto"
+	"github.com/anyproto/any-sync/nameservice/nameserviceproto"
+	"github.com/anyproto/any-sync/net/connutil"
+	"github.com/anyproto/any-sync/net/peer"
+	"github.com/anyproto/any-sync/net/secureservice"
+	"github.com/anyproto/any-sync/net/secureservice/handshake"
+	"github.com/anyproto/any-sync/net/secureservice/handshake/handshakeproto"
+	"github.com/anyproto/any-sync/net/transport"
+	"github.com/anyproto/any-sync/net/transport/quic"
+	"github.com/anyproto/any-sync/net/transport/yamux"
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/anyproto/any-sync/paymentservice/paymentserviceproto"
+	yamux2 "github.com/hashicorp/yamux"
+	"go.uber.org/zap"
+	"storj.io/drpc"
+	"storj.io/drpc/drpcconn"
+)
+
+// target is a node to probe. The addresses of -addrs have no peer id and are probed as coordinators
+type target struct {
+	PeerId string
+	Types  []nodeconf.NodeType
+	// Addrs have the yamux:// or quic:// scheme
+	Addrs []string
+}
+
+// nodeTargets returns every node of the config, the addresses without a scheme are yamux ones
+func nodeTargets(conf nodeconf.Configuration) (targets []target) {
+	for _, node := range conf.Nodes {
+		t := target{PeerId: node.PeerId, Types: node.Types}
+		for _, address := range node.Addresses {
+			if !strings.HasPrefix(address, "quic://") {
+				address = "yamux://" + address
+			}
+			t.Addrs = append(t.Addrs, address)
+		}
+		targets = append(targets, t)
+	}
+	return
+}
+
+func addrTargets(addrs []string) (targets []target) {
+	for _, addr := range addrs {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			targets = append(targets, target{Types: []nodeconf.NodeType{nodeconf.NodeTypeCoordinator}, Addrs: []string{addr}})
+		}
+	}
+	return
+}
+
+// probeAll probes the addresses of the targets concurrently, at most -parallel at once.
+// The results are in the order of the targets, the probes not started before ctx is done fail with its error
+func probeAll(ctx context.Context, a *app.App, targets []target) []probeResult {
+	type job struct {
+		t    target
+		addr string
+	}
+	var jobs []job
+	for _, t := range targets {
+		for _, addr := range t.Addrs {
+			jobs = append(jobs, job{t, addr})
+		}
+	}
+
+	results := make([]probeResult, len(jobs))
+	sem := make(chan struct{}, *parallel)
+	var wg sync.WaitGroup
+	for i, j := range jobs {
+		if !acquire(ctx, sem) {
+			results[i] = probeResult{PeerId: j.t.PeerId, Types: j.t.Types, Addr: j.addr, Err: fmt.Errorf("%w: %w", errNotProbed, ctx.Err())}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, j job) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = probe(ctx, a, j.t, j.addr)
+		}(i, j)
+	}
+	wg.Wait()
+	return results
+}
+
+// acquire takes a slot of the semaphore unless ctx is done. select picks at random when both cases are ready,
+// so ctx is checked around it to not start a probe after the deadline
+func acquire(ctx context.Context, sem chan struct{}) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	if ctx.Err() != nil {
+		<-sem
+		return false
+	}
+	return true
+}
+
+func probe(ctx context.Context, a *app.App, t target, addr string) (res probeResult) {
+	res = probeResult{PeerId: t.PeerId, Types: t.Types, Addr: addr}
+	l := log.With(zap.String("addr", addr))
+	if t.PeerId != "" {
+		l = l.With(zap.String("peerId", t.PeerId))
+	}
+
+	st := time.Now()
+	defer func() {
+		res.Dur = time.Since(st)
+	}()
+	var mc transport.MultiConn
+	switch {
+	case strings.HasPrefix(addr, "yamux://"):
+		mc, res.Err = dialYamux(ctx, a, l, addr[8:], &res)
+	case strings.HasPrefix(addr, "quic://"):
+		mc, res.Err = dialQuic(ctx, a, l, addr[7:], &res)
+	default:
+		res.Err = errUnexpectedScheme
+		l.Warn("unexpected address scheme")
+	}
+	if res.Err != nil {
+		return
+	}
+	defer mc.Close()
+	l = l.With(zap.String("ip", res.RemoteIp))
+
+	// the handshake proves the identity of the remote peer, so a wrong node behind the address is detected
+	res.RemotePeerId, _ = peer.CtxPeerId(mc.Context())
+	if t.PeerId != "" && res.RemotePeerId != t.PeerId {
+		res.Err = fmt.Errorf("%w: the address is served by %s", errWrongPeer, res.RemotePeerId)
+		l.Warn("unexpected peer", zap.String("remotePeerId", res.RemotePeerId))
+		return
+	}
+
+	res.Requests = make(map[nodeconf.NodeType]error, len(t.Types))
+	failed := false
+	for _, nodeType := range t.Types {
+		if res.Requests[nodeType] = request(ctx, l, mc, nodeType, &res); res.Requests[nodeType] != nil {
+			failed = true
+		}
+	}
+	if !failed {
+		l.Info("success", zap.Duration("dur", time.Since(st)))
+	}
+	return
+}
+
+func dialYamux(ctx context.Context, a *app.App, l logger.CtxLogger, addr string, res *probeResult) (transport.MultiConn, error) {
+	ss := a.MustComponent(secureservice.CName).(secureservice.SecureService)
+
+	l.Debug("open TCP conn")
+	st := time.Now()
+	dctx, cancel := context.WithTimeout(ctx, *dialTimeout)
+	defer cancel()
+	conn, err := new(net.Dialer).DialContext(dctx, "tcp", addr)
+	res.record(stageDial, "", st, err)
+	if err != nil {
+		l.Warn("open TCP conn error", zap.Error(err), zap.Duration("dur", time.Since(st)))
+		return nil, err
+	} else {
+		l.Debug("TCP conn established", zap.Duration("dur", time.Since(st)))
+		res.setRemoteAddr(conn.RemoteAddr().String())
+	}
+
+	l.Debug("start handshake")
+	hst := time.Now()
+	hctx, cancel := context.WithTimeout(ctx, *handshakeTimeout)
+	defer cancel()
+	// the deadline stops the handshake reads of a peer that accepted the connection and went silent
+	_ = conn.SetDeadline(deadlineOf(hctx))
+	cctx, err := ss.SecureOutbound(hctx, conn)
+	_ = conn.SetDeadline(time.Time{})
+	res.record(stageHandshake, "", hst, err)
+	if err != nil {
+		l.Warn("handshake error", zap.Error(err), zap.Duration("dur", time.Since(hst)))
+		_ = conn.Close()
+		return nil, err
+	} else {
+		l.Debug("handshake success", zap.Duration("dur", time.Since(hst)), zap.Duration("total", time.Since(st)))
+	}
+
+	yst := time.Now()
+	l.Debug("open yamux session")
+	sess, err := yamux2.Client(conn, yamux2.DefaultConfig())
+	res.record(stageSession, "", yst, err)
+	if err != nil {
+		l.Warn("yamux session error", zap.Error(err), zap.Duration("dur", time.Since(yst)))
+		_ = conn.Close()
+		return nil, err
+	} else {
+		l.Debug("yamux session success", zap.Duration("dur", time.Since(yst)), zap.Duration("total", time.Since(st)))
+	}
+	return yamux.NewMultiConn(cctx, connutil.NewLastUsageConn(conn), conn.RemoteAddr().String(), sess), nil
+}
+
+// dialQuic dials and performs the handshakes, so both timeouts apply to it
+func dialQuic(ctx context.Context, a *app.App, l logger.CtxLogger, addr string, res *probeResult) (transport.MultiConn, error) {
+	qs := a.MustComponent(quic.CName).(quic.Quic)
+
+	l.Debug("open QUIC conn")
+	st := time.Now()
+	dctx, cancel := context.WithTimeout(ctx, *dialTimeout+*handshakeTimeout)
+	defer cancel()
+	mc, err := qs.Dial(dctx, addr)
+	// the quic dial includes the handshakes, the stage covers both
+	res.record(stageDial, "", st, err)
+	if err != nil {
+		l.Warn("open QUIC conn error", zap.Error(err), zap.Duration("dur", time.Since(st)))
+		return nil, err
+	}
+	l.Debug("QUIC conn established", zap.Duration("dur", time.Since(st)))
+	res.setRemoteAddr(mc.Addr())
+	return mc, nil
+}
+
+// request opens a sub connection and sends the request of the node type over it, all within -request-timeout
+func request(ctx context.Context, l logger.CtxLogger, mc transport.MultiConn, nodeType nodeconf.NodeType, res *probeResult) error {
+	l = l.With(zap.String("type", string(nodeType)))
+	ctx, cancel := context.WithTimeout(ctx, *requestTimeout)
+	defer cancel()
+
+	l.Debug("open sub connection")
+	scst := time.Now()
+	sc, err := mc.Open(ctx)
+	res.record(stageSubConn, nodeType, scst, err)
+	if err != nil {
+		l.Warn("open sub connection error", zap.Error(err), zap.Duration("dur", time.Since(scst)))
+		return err
+	} else {
+		l.Debug("open sub conn success", zap.Duration("dur", time.Since(scst)))
+		defer sc.Close()
+		_ = sc.SetDeadline(deadlineOf(ctx))
+	}
+
+	l.Debug("start proto handshake")
+	phst := time.Now()
+	if _, err = handshake.OutgoingProtoHandshake(ctx, sc, &handshakeproto.Proto{
+		Proto:     handshakeproto.ProtoType_DRPC,
+		Encodings: []handshakeproto.Encoding{handshakeproto.Encoding_None},
+	}); err != nil {
+		res.record(stageProtoHandshake, nodeType, phst, err)
+		l.Warn("proto handshake error", zap.Duration("dur", time.Since(phst)), zap.Error(err))
+		return err
+	} else {
+		res.record(stageProtoHandshake, nodeType, phst, nil)
+		l.Debug("proto handshake success", zap.Duration("dur", time.Since(phst)))
+	}
+
+	l.Debug("start request")
+	rst := time.Now()
+	networkId, err := typeRequest(ctx, drpcconn.New(sc), nodeType)
+	switch {
+	case errors.Is(err, errNoRequest):
+		l.Debug("no request for the node type, only the connection is checked")
+		return nil
+	case err != nil && !answered(err):
+		l.Warn("request error", zap.Error(err), zap.Duration("dur", time.Since(rst)))
+		res.record(stageRequest, nodeType, rst, err)
+		return err
+	case err != nil && strings.Contains(err.Error(), "unknown rpc"):
+		l.Warn("the node doesn't serve the type", zap.Error(err), zap.Duration("dur", time.Since(rst)))
+		err = fmt.Errorf("%w: no %s requests", errUnsupportedType, nodeType)
+		res.record(stageRequest, nodeType, rst, err)
+		return err
+	}
+	res.record(stageRequest, nodeType, rst, nil)
+	if networkId != "" {
+		res.NetworkId = networkId
+	}
+	l.Debug("request answered", zap.Duration("dur", time.Since(rst)), zap.NamedError("reply", err))
+	return nil
+}
+
+var errNoRequest = errors.New("no request for the node type")
+
+// typeRequest sends a lightweight request the nodes of the type serve. It changes nothing on the node.
+// The coordinators return the network id
+func typeRequest(ctx context.Context, conn drpc.Conn, nodeType nodeconf.NodeType) (networkId string, err error) {
+	switch nodeType {
+	case nodeconf.NodeTypeCoordinator:
+		var resp *coordinatorproto.NetworkConfigurationResponse
+		if resp, err = coordinatorproto.NewDRPCCoordinatorClient(conn).NetworkConfiguration(ctx, &coordinatorproto.NetworkConfigurationRequest{}); err == nil {
+			networkId = resp.NetworkId
+		}
+	case nodeconf.NodeTypeTree:
+		_, err = spacesyncproto.NewDRPCSpaceSyncClient(conn).SpacePull(ctx, &spacesyncproto.SpacePullRequest{Id: "netcheck"})
+	case nodeconf.NodeTypeFile:
+		_, err = fileproto.NewDRPCFileClient(conn).Check(ctx, &fileproto.CheckRequest{})
+	case nodeconf.NodeTypeConsensus:
+		// consensus nodes have no read-only unary call, only the connection is checked
+		err = errNoRequest
+	case nodeconf.NodeTypeNamingNode:
+		_, err = nameserviceproto.NewDRPCAnynsClient(conn).IsNameAvailable(ctx, &nameserviceproto.NameAvailableRequest{FullName: "netcheck.any"})
+	case nodeconf.NodeTypePaymentProcessingNode:
+		_, err = paymentserviceproto.NewDRPCAnyPaymentProcessingClient(conn).IsNameValid(ctx, &paymentserviceproto.IsNameValidRequest{RequestedAnyName: "netcheck"})
+	default:
+		err = errNoRequest
+	}
+	return
+}
+
+func deadlineOf(ctx context.Context) time.Time {
+	deadline, _ := ctx.Deadline()
+	return deadline
+}
+
+// answered reports whether the request reached the node. The errors the node replies with,
+// e.g. a missing space or no permission, come without a drpc class and mean the node is reachable
+func answered(err error) bool {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return true
+	case drpc.ClosedError.Has(err), drpc.ProtocolError.Has(err), drpc.InternalError.Has(err):
+		return false
+	case errors.Is(err, io.EOF), errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled), errors.As(err, &netErr):
+		return false
+	}
+	return true
+}
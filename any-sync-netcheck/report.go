@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/anyproto/any-sync/nodeconf"
+)
+
+// peerReport is the reachability of a node by type. A node is reachable for a type if any of its addresses answered
+type peerReport struct {
+	// Name is the peer id or the address for -addrs
+	Name      string
+	Types     []nodeconf.NodeType
+	Reachable map[nodeconf.NodeType]int
+	Addrs     int
+	// Errs are the failures of the addresses
+	Errs []string
+}
+
+func (p peerReport) ok() bool {
+	for _, nodeType := range p.Types {
+		if p.Reachable[nodeType] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// peerReports groups the results by node in the order of the targets
+func peerReports(targets []target, results []probeResult) (reports []peerReport) {
+	idx := map[string]int{}
+	for _, t := range targets {
+		name := t.PeerId
+		if name == "" {
+			name = t.Addrs[0]
+		}
+		idx[name] = len(reports)
+		reports = append(reports, peerReport{Name: name, Types: t.Types, Reachable: map[nodeconf.NodeType]int{}})
+	}
+	for _, res := range results {
+		name := res.PeerId
+		if name == "" {
+			name = res.Addr
+		}
+		p := &reports[idx[name]]
+		p.Addrs++
+		if res.Err != nil {
+			p.Errs = append(p.Errs, fmt.Sprintf("%s: %v", res.Addr, res.Err))
+			continue
+		}
+		for _, nodeType := range res.Types {
+			if res.ok(nodeType) {
+				p.Reachable[nodeType]++
+			} else {
+				p.Errs = append(p.Errs, fmt.Sprintf("%s %s: %v", res.Addr, nodeType, res.Requests[nodeType]))
+			}
+		}
+	}
+	return
+}
+
+// printReport prints the reachability per peer and per type, it returns false if some node isn't reachable
+func printReport(reports []peerReport) bool {
+	allOk := true
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\nPEER\tTYPES\tSTATUS")
+	var typeOrder []nodeconf.NodeType
+	typePeers := map[nodeconf.NodeType][2]int{}
+	for _, p := range reports {
+		var types []string
+		for _, nodeType := range p.Types {
+			types = append(types, string(nodeType))
+			counts, seen := typePeers[nodeType]
+			if !seen {
+				typeOrder = append(typeOrder, nodeType)
+			}
+			counts[1]++
+			if p.Reachable[nodeType] > 0 {
+				counts[0]++
+			}
+			typePeers[nodeType] = counts
+		}
+		status := "ok"
+		if !p.ok() {
+			status = "FAIL"
+			allOk = false
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.Name, strings.Join(types, ","), status)
+		for _, e := range p.Errs {
+			fmt.Fprintf(w, "\t\t%s\n", e)
+		}
+	}
+
+	fmt.Fprintln(w, "\nTYPE\tREACHABLE PEERS")
+	for _, nodeType := range typeOrder {
+		counts := typePeers[nodeType]
+		fmt.Fprintf(w, "%s\t%d/%d\n", nodeType, counts[0], counts[1])
+	}
+	_ = w.Flush()
+	return allOk
+}
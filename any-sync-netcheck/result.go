@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/anyproto/any-sync/net/secureservice/handshake"
+	"github.com/anyproto/any-sync/nodeconf"
+	"storj.io/drpc"
+)
+
+// the stages of a probe in the order they run, the request stages repeat for every node type
+const (
+	stageDial           = "dial"
+	stageHandshake      = "handshake"
+	stageSession        = "session"
+	stageSubConn        = "subConn"
+	stageProtoHandshake = "protoHandshake"
+	stageRequest        = "request"
+)
+
+var (
+	errUnexpectedScheme = errors.New("unexpected address scheme")
+	errWrongPeer        = errors.New("wrong peer")
+	errNotProbed        = errors.New("not probed")
+	errUnsupportedType  = errors.New("the node doesn't serve the type")
+)
+
+// probeResult is the result of one address of a node
+type probeResult struct {
+	PeerId string
+	Types  []nodeconf.NodeType
+	Addr   string
+	// Err is the connection error, no requests are sent then
+	Err error
+	// Requests are the errors of the requests of the node types, nil for the answered ones
+	Requests map[nodeconf.NodeType]error
+	Dur      time.Duration
+
+	RemoteIp     string
+	RemotePeerId string
+	// NetworkId is returned by the coordinators
+	NetworkId string
+	Stages    []stageResult
+}
+
+// stageResult is one step of the probe, Type is set for the request stages
+type stageResult struct {
+	Stage string
+	Type  nodeconf.NodeType
+	Dur   time.Duration
+	Err   error
+}
+
+// ok reports whether the address answered the request of the type
+func (r probeResult) ok(nodeType nodeconf.NodeType) bool {
+	return r.Err == nil && r.Requests[nodeType] == nil
+}
+
+// record adds the stage started at st
+func (r *probeResult) record(stage string, nodeType nodeconf.NodeType, st time.Time, err error) {
+	r.Stages = append(r.Stages, stageResult{Stage: stage, Type: nodeType, Dur: time.Since(st), Err: err})
+}
+
+// setRemoteAddr keeps the ip of the host:port address
+func (r *probeResult) setRemoteAddr(addr string) {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		r.RemoteIp = host
+	} else {
+		r.RemoteIp = addr
+	}
+}
+
+// reached returns the last stage that succeeded
+func (r probeResult) reached() (stage string) {
+	for _, s := range r.Stages {
+		if s.Err != nil {
+			break
+		}
+		stage = s.Stage
+	}
+	return
+}
+
+// failure returns the first error of the probe with its stage and node type
+func (r probeResult) failure() (stageResult, bool) {
+	for _, s := range r.Stages {
+		if s.Err != nil {
+			return s, true
+		}
+	}
+	if r.Err != nil {
+		// the errors after the connection, e.g. a wrong peer, belong to no stage
+		return stageResult{Err: r.Err}, true
+	}
+	for _, nodeType := range r.Types {
+		if err := r.Requests[nodeType]; err != nil {
+			return stageResult{Stage: stageRequest, Type: nodeType, Err: err}, true
+		}
+	}
+	return stageResult{}, false
+}
+
+// classifyError maps the error to a stable class, so the results can be grouped without parsing the messages
+func classifyError(err error) string {
+	var (
+		dnsErr       *net.DNSError
+		netErr       net.Error
+		handshakeErr handshake.HandshakeError
+	)
+	// the handshake errors keep the cause, e.g. a timeout, without unwrapping it
+	if errors.As(err, &handshakeErr) && handshakeErr.Err != nil {
+		if class := classifyError(handshakeErr.Err); class != "other" {
+			return class
+		}
+	}
+	switch {
+	case errors.Is(err, errNotProbed):
+		return "not_probed"
+	case errors.Is(err, errUnexpectedScheme):
+		return "bad_address"
+	case errors.Is(err, errWrongPeer):
+		return "wrong_peer"
+	case errors.Is(err, errUnsupportedType):
+		return "unsupported_type"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "unreachable"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, handshake.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, handshake.ErrIncompatibleVersion):
+		return "incompatible_version"
+	case errors.As(err, &handshakeErr), strings.Contains(err.Error(), "tls:"):
+		return "handshake"
+	case errors.Is(err, io.EOF), errors.Is(err, syscall.ECONNRESET), drpc.ClosedError.Has(err):
+		return "connection_closed"
+	}
+	return "other"
+}
+
+type jsonError struct {
+	Class   string `json:"class"`
+	Stage   string `json:"stage,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Message string `json:"message"`
+}
+
+type jsonStage struct {
+	Stage      string     `json:"stage"`
+	Type       string     `json:"type,omitempty"`
+	DurationMs float64    `json:"durationMs"`
+	Error      *jsonError `json:"error,omitempty"`
+}
+
+// jsonResult is the line -format json writes for every address
+type jsonResult struct {
+	PeerId       string      `json:"peerId,omitempty"`
+	Types        []string    `json:"types"`
+	Addr         string      `json:"addr"`
+	Ok           bool        `json:"ok"`
+	Stage        string      `json:"stage"`
+	DurationMs   float64     `json:"durationMs"`
+	Stages       []jsonStage `json:"stages"`
+	RemoteIp     string      `json:"remoteIp,omitempty"`
+	RemotePeerId string      `json:"remotePeerId,omitempty"`
+	NetworkId    string      `json:"networkId,omitempty"`
+	Error        *jsonError  `json:"error,omitempty"`
+}
+
+func newJsonError(s stageResult) *jsonError {
+	if s.Err == nil {
+		return nil
+	}
+	return &jsonError{Class: classifyError(s.Err), Stage: s.Stage, Type: string(s.Type), Message: s.Err.Error()}
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (r probeResult) json() jsonResult {
+	res := jsonResult{
+		PeerId:       r.PeerId,
+		Types:        []string{},
+		Addr:         r.Addr,
+		Stage:        r.reached(),
+		DurationMs:   durationMs(r.Dur),
+		Stages:       []jsonStage{},
+		RemoteIp:     r.RemoteIp,
+		RemotePeerId: r.RemotePeerId,
+		NetworkId:    r.NetworkId,
+	}
+	for _, nodeType := range r.Types {
+		res.Types = append(res.Types, string(nodeType))
+	}
+	for _, s := range r.Stages {
+		res.Stages = append(res.Stages, jsonStage{Stage: s.Stage, Type: string(s.Type), DurationMs: durationMs(s.Dur), Error: newJsonError(s)})
+	}
+	failure, failed := r.failure()
+	res.Ok = !failed
+	res.Error = newJsonError(failure)
+	return res
+}
+
+// printJson writes one JSON object per line for every address
+func printJson(w io.Writer, results []probeResult) {
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		_ = enc.Encode(r.json())
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/anyproto/any-sync/net/secureservice/handshake"
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		err   error
+		class string
+	}{
+		{"dns", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "node.example", IsNotFound: true}}, "dns"},
+		{"refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, "connection_refused"},
+		{"unreachable", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)}, "unreachable"},
+		{"timeout", fmt.Errorf("dial: %w", context.DeadlineExceeded), "timeout"},
+		{"handshake timeout", handshake.ErrDeadlineExceeded, "timeout"},
+		{"handshake-wrapped timeout", handshake.HandshakeError{Err: context.DeadlineExceeded}, "timeout"},
+		{"handshake", handshake.ErrInvalidCredentials, "handshake"},
+		{"incompatible version", handshake.ErrIncompatibleVersion, "incompatible_version"},
+		{"wrong peer", fmt.Errorf("%w: the address is served by 12D3KooW", errWrongPeer), "wrong_peer"},
+		// the deadline of the run is the cause, still the address was never probed
+		{"not probed", fmt.Errorf("%w: %w", errNotProbed, context.DeadlineExceeded), "not_probed"},
+		{"unsupported type", errUnsupportedType, "unsupported_type"},
+		{"bad address", fmt.Errorf("%w: tcp://127.0.0.1", errUnexpectedScheme), "bad_address"},
+		{"closed", io.EOF, "connection_closed"},
+		{"other", errors.New("something else"), "other"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.class, classifyError(tc.err))
+		})
+	}
+}
+
+func TestProbeResult_Failure(t *testing.T) {
+	refused := os.NewSyscallError("connect", syscall.ECONNREFUSED)
+	for _, tc := range []struct {
+		name    string
+		res     probeResult
+		reached string
+		failed  bool
+		failure stageResult
+	}{
+		{
+			name: "ok",
+			res: probeResult{
+				Types:    []nodeconf.NodeType{nodeconf.NodeTypeTree},
+				Requests: map[nodeconf.NodeType]error{nodeconf.NodeTypeTree: nil},
+				Stages:   []stageResult{{Stage: stageDial}, {Stage: stageHandshake}, {Stage: stageRequest, Type: nodeconf.NodeTypeTree}},
+			},
+			reached: stageRequest,
+		},
+		{
+			name: "dial failed",
+			res: probeResult{
+				Err:    refused,
+				Stages: []stageResult{{Stage: stageDial, Err: refused}},
+			},
+			failed:  true,
+			failure: stageResult{Stage: stageDial, Err: refused},
+		},
+		{
+			name: "handshake failed",
+			res: probeResult{
+				Err:    handshake.ErrInvalidCredentials,
+				Stages: []stageResult{{Stage: stageDial}, {Stage: stageHandshake, Err: handshake.ErrInvalidCredentials}},
+			},
+			reached: stageDial,
+			failed:  true,
+			failure: stageResult{Stage: stageHandshake, Err: handshake.ErrInvalidCredentials},
+		},
+		{
+			name: "wrong peer",
+			res: probeResult{
+				Err:    errWrongPeer,
+				Stages: []stageResult{{Stage: stageDial}, {Stage: stageHandshake}},
+			},
+			reached: stageHandshake,
+			failed:  true,
+			failure: stageResult{Err: errWrongPeer},
+		},
+		{
+			name: "request failed",
+			res: probeResult{
+				Types:    []nodeconf.NodeType{nodeconf.NodeTypeCoordinator, nodeconf.NodeTypeFile},
+				Requests: map[nodeconf.NodeType]error{nodeconf.NodeTypeCoordinator: nil, nodeconf.NodeTypeFile: errUnsupportedType},
+				Stages:   []stageResult{{Stage: stageDial}, {Stage: stageHandshake}},
+			},
+			reached: stageHandshake,
+			failed:  true,
+			failure: stageResult{Stage: stageRequest, Type: nodeconf.NodeTypeFile, Err: errUnsupportedType},
+		},
+		{
+			name:    "not probed",
+			res:     probeResult{Err: errNotProbed},
+			failed:  true,
+			failure: stageResult{Err: errNotProbed},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.reached, tc.res.reached())
+			failure, failed := tc.res.failure()
+			assert.Equal(t, tc.failed, failed)
+			assert.Equal(t, tc.failure, failure)
+		})
+	}
+}
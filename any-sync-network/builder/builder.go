@@ -0,0 +1,416 @@
+// Package builder builds any-sync network configurations.
+// It contains no interactive or filesystem logic, so it can be used from other Go programs.
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/anyproto/any-sync/accountservice"
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/anyproto/any-sync/util/crypto"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrNoCoordinator = errors.New("network must contain at least one coordinator node")
+	ErrNoListenAddr  = errors.New("node listen address is not specified")
+)
+
+// Option configures the Builder
+type Option func(b *Builder)
+
+// WithNetworkKey sets the network key. By default, a new key is generated by the key provider
+func WithNetworkKey(key crypto.PrivKey) Option {
+	return func(b *Builder) {
+		b.netPrivKey = key
+	}
+}
+
+// WithKeyProvider sets the provider of the network and node keys. By default, the keys are generated in process
+func WithKeyProvider(keys KeyProvider) Option {
+	return func(b *Builder) {
+		b.keys = keys
+	}
+}
+
+// WithConfigurationId sets the network configuration id. By default, a new object id is generated
+func WithConfigurationId(id string) Option {
+	return func(b *Builder) {
+		b.network.ID = id
+	}
+}
+
+// WithExternalAddresses sets the hosts every node is additionally reachable on
+func WithExternalAddresses(addrs ...string) Option {
+	return func(b *Builder) {
+		b.externalAddrs = addrs
+	}
+}
+
+// NodeOption configures a node added to the Builder
+type NodeOption func(o *nodeOptions)
+
+type nodeOptions struct {
+	listenAddr        string
+	yamuxPort         int
+	quicPort          int
+	externalYamuxPort int
+	externalQuicPort  int
+	account           *accountservice.Config
+	mongoConnect      string
+	mongoDatabase     string
+	spaceLimits       SpaceLimits
+	s3Store           S3StoreConfig
+	redis             RedisConfig
+	defaultLimit      int
+}
+
+// WithListen sets the host and ports the node listens on
+func WithListen(addr string, yamuxPort, quicPort int) NodeOption {
+	return func(o *nodeOptions) {
+		o.listenAddr = addr
+		o.yamuxPort = yamuxPort
+		o.quicPort = quicPort
+	}
+}
+
+// WithExternalPorts sets the ports used with the external addresses. By default, the listen ports are used
+func WithExternalPorts(yamuxPort, quicPort int) NodeOption {
+	return func(o *nodeOptions) {
+		o.externalYamuxPort = yamuxPort
+		o.externalQuicPort = quicPort
+	}
+}
+
+// WithAccount sets an existing node account instead of generating a new one
+func WithAccount(account accountservice.Config) NodeOption {
+	return func(o *nodeOptions) {
+		o.account = &account
+	}
+}
+
+// WithMongo sets the mongo connection of coordinator and consensus nodes
+func WithMongo(connect, database string) NodeOption {
+	return func(o *nodeOptions) {
+		o.mongoConnect = connect
+		o.mongoDatabase = database
+	}
+}
+
+// WithSpaceLimits sets the default space limits of a coordinator node
+func WithSpaceLimits(limits SpaceLimits) NodeOption {
+	return func(o *nodeOptions) {
+		o.spaceLimits = limits
+	}
+}
+
+// WithS3Store sets the storage of a file node
+func WithS3Store(s3Store S3StoreConfig) NodeOption {
+	return func(o *nodeOptions) {
+		o.s3Store = s3Store
+	}
+}
+
+// WithRedis sets the redis connection of a file node
+func WithRedis(redis RedisConfig) NodeOption {
+	return func(o *nodeOptions) {
+		o.redis = redis
+	}
+}
+
+// WithDefaultLimit sets the default space storage limit of a file node
+func WithDefaultLimit(limit int) NodeOption {
+	return func(o *nodeOptions) {
+		o.defaultLimit = limit
+	}
+}
+
+// Builder collects the nodes of a network and produces their configs
+type Builder struct {
+	keys          KeyProvider
+	netPrivKey    crypto.PrivKey
+	netKey        Key
+	network       Network
+	externalAddrs []string
+	coordinators  []CoordinatorNodeConfig
+	consensus     []ConsensusNodeConfig
+	syncNodes     []SyncNodeConfig
+	fileNodes     []FileNodeConfig
+	namingNodes   []GeneralNodeConfig
+	paymentNodes  []GeneralNodeConfig
+}
+
+// New creates a Builder for a new network
+func New(opts ...Option) (*Builder, error) {
+	b := &Builder{
+		network: Network{
+			HeartConfig: HeartConfig{
+				Nodes: []Node{},
+			},
+		},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.keys == nil {
+		b.keys = LocalKeyProvider{}
+	}
+	var err error
+	if b.netPrivKey != nil {
+		b.netKey, err = LocalKey(b.netPrivKey)
+	} else {
+		b.netKey, err = b.keys.GenerateKey()
+	}
+	if err != nil {
+		return nil, &KeyError{Err: fmt.Errorf("can't generate network key: %w", err)}
+	}
+	if b.network.ID == "" {
+		b.network.ID = bson.NewObjectId().Hex()
+	}
+	b.network.NetworkID = b.netKey.PubKey.Network()
+	return b, nil
+}
+
+// NetworkKey returns the network private key, it is nil if the key is kept by an external key provider
+func (b *Builder) NetworkKey() crypto.PrivKey {
+	if _, local := b.keys.(LocalKeyProvider); local && b.netPrivKey == nil {
+		b.netPrivKey, _ = crypto.DecodeKeyFromString(b.netKey.Ref, crypto.UnmarshalEd25519PrivateKey, nil)
+	}
+	return b.netPrivKey
+}
+
+// NetworkId returns the network id derived from the network key
+func (b *Builder) NetworkId() string {
+	return b.network.NetworkID
+}
+
+// AddCoordinator adds a coordinator node signed by the network key
+func (b *Builder) AddCoordinator(opts ...NodeOption) (node CoordinatorNodeConfig, err error) {
+	o := newNodeOptions(opts)
+	node = defaultCoordinatorNode()
+	if err = b.initNode(&node.GeneralNodeConfig, o); err != nil {
+		return
+	}
+	node.Account.SigningKey = b.netKey.Ref
+	node.Mongo.Connect = o.mongoConnect
+	node.Mongo.Database = o.mongoDatabase
+	node.DefaultLimits = o.spaceLimits
+
+	b.addToNetwork(node.GeneralNodeConfig, nodeconf.NodeTypeCoordinator, o)
+	b.coordinators = append(b.coordinators, node)
+	return
+}
+
+// AddConsensus adds a consensus node
+func (b *Builder) AddConsensus(opts ...NodeOption) (node ConsensusNodeConfig, err error) {
+	o := newNodeOptions(opts)
+	node = defaultConsensusNode()
+	if err = b.initNode(&node.GeneralNodeConfig, o); err != nil {
+		return
+	}
+	node.Mongo.Connect = o.mongoConnect
+	node.Mongo.Database = o.mongoDatabase
+
+	b.addToNetwork(node.GeneralNodeConfig, nodeconf.NodeTypeConsensus, o)
+	b.consensus = append(b.consensus, node)
+	return
+}
+
+// AddSyncNode adds a tree (sync) node
+func (b *Builder) AddSyncNode(opts ...NodeOption) (node SyncNodeConfig, err error) {
+	o := newNodeOptions(opts)
+	node = defaultSyncNode()
+	if err = b.initNode(&node.GeneralNodeConfig, o); err != nil {
+		return
+	}
+
+	b.addToNetwork(node.GeneralNodeConfig, nodeconf.NodeTypeTree, o)
+	b.syncNodes = append(b.syncNodes, node)
+	return
+}
+
+// AddFileNode adds a file node
+func (b *Builder) AddFileNode(opts ...NodeOption) (node FileNodeConfig, err error) {
+	o := newNodeOptions(opts)
+	node = defaultFileNode()
+	if err = b.initNode(&node.GeneralNodeConfig, o); err != nil {
+		return
+	}
+	node.DefaultLimit = o.defaultLimit
+	maxThreads := node.S3Store.MaxThreads
+	node.S3Store = o.s3Store
+	if node.S3Store.MaxThreads == 0 {
+		node.S3Store.MaxThreads = maxThreads
+	}
+	node.Redis = o.redis
+
+	b.addToNetwork(node.GeneralNodeConfig, nodeconf.NodeTypeFile, o)
+	b.fileNodes = append(b.fileNodes, node)
+	return
+}
+
+// AddNamingNode adds a naming node. Only the common part of its config is generated,
+// service specific sections can be added with a node template
+func (b *Builder) AddNamingNode(opts ...NodeOption) (node GeneralNodeConfig, err error) {
+	o := newNodeOptions(opts)
+	node = defaultGeneralNode()
+	if err = b.initNode(&node, o); err != nil {
+		return
+	}
+
+	b.addToNetwork(node, nodeconf.NodeTypeNamingNode, o)
+	b.namingNodes = append(b.namingNodes, node)
+	return
+}
+
+// AddPaymentProcessingNode adds a payment processing node. Only the common part of its config is generated,
+// service specific sections can be added with a node template
+func (b *Builder) AddPaymentProcessingNode(opts ...NodeOption) (node GeneralNodeConfig, err error) {
+	o := newNodeOptions(opts)
+	node = defaultGeneralNode()
+	if err = b.initNode(&node, o); err != nil {
+		return
+	}
+
+	b.addToNetwork(node, nodeconf.NodeTypePaymentProcessingNode, o)
+	b.paymentNodes = append(b.paymentNodes, node)
+	return
+}
+
+func newNodeOptions(opts []NodeOption) nodeOptions {
+	var o nodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.externalYamuxPort == 0 {
+		o.externalYamuxPort = o.yamuxPort
+	}
+	if o.externalQuicPort == 0 {
+		o.externalQuicPort = o.quicPort
+	}
+	return o
+}
+
+func (b *Builder) initNode(node *GeneralNodeConfig, o nodeOptions) (err error) {
+	if o.listenAddr == "" {
+		return ErrNoListenAddr
+	}
+	node.Yamux.ListenAddrs = append(node.Yamux.ListenAddrs, net.JoinHostPort(o.listenAddr, strconv.Itoa(o.yamuxPort)))
+	node.Quic.ListenAddrs = append(node.Quic.ListenAddrs, net.JoinHostPort(o.listenAddr, strconv.Itoa(o.quicPort)))
+	if o.account != nil {
+		node.Account = *o.account
+		return
+	}
+	node.Account, err = generateAccount(b.keys)
+	return
+}
+
+func (b *Builder) addToNetwork(node GeneralNodeConfig, nodeType nodeconf.NodeType, o nodeOptions) {
+	var addresses []string
+	for _, addr := range node.Yamux.ListenAddrs {
+		addresses = append(addresses, addr)
+	}
+	for _, addr := range node.Quic.ListenAddrs {
+		addresses = append(addresses, "quic://"+addr)
+	}
+	for _, extAddr := range b.externalAddrs {
+		addresses = append(addresses, net.JoinHostPort(extAddr, strconv.Itoa(o.externalYamuxPort)))
+		addresses = append(addresses, "quic://"+net.JoinHostPort(extAddr, strconv.Itoa(o.externalQuicPort)))
+	}
+	b.network.Nodes = append(b.network.Nodes, Node{
+		PeerID:    node.Account.PeerId,
+		Addresses: addresses,
+		Types:     []string{string(nodeType)},
+	})
+}
+
+// generateAccount returns a new account signed by its own peer key. Only coordinators sign with the network key
+func generateAccount(keys KeyProvider) (accountservice.Config, error) {
+	peerKey, err := keys.GenerateKey()
+	if err != nil {
+		return accountservice.Config{}, &KeyError{Err: fmt.Errorf("can't generate node key: %w", err)}
+	}
+
+	return accountservice.Config{
+		PeerId:     peerKey.PubKey.PeerId(),
+		PeerKey:    peerKey.Ref,
+		SigningKey: peerKey.Ref,
+	}, nil
+}
+
+// Result contains the configs of all the nodes of the network
+type Result struct {
+	Network        Network
+	Coordinators   []CoordinatorNodeConfig
+	ConsensusNodes []ConsensusNodeConfig
+	SyncNodes      []SyncNodeConfig
+	FileNodes      []FileNodeConfig
+	NamingNodes    []GeneralNodeConfig
+	PaymentNodes   []GeneralNodeConfig
+	Configuration  nodeconf.Configuration
+}
+
+// Build returns the configs of all added nodes with the complete network list in each of them
+func (b *Builder) Build() (res Result, err error) {
+	if len(b.coordinators) == 0 {
+		return res, ErrNoCoordinator
+	}
+	return b.BuildPartial()
+}
+
+// BuildPartial is Build without the coordinator requirement, for node sets that join or extend a network
+func (b *Builder) BuildPartial() (res Result, err error) {
+	res.Network = b.network
+	for _, node := range b.coordinators {
+		node.Network = b.network
+		res.Coordinators = append(res.Coordinators, node)
+	}
+	for _, node := range b.consensus {
+		node.Network = b.network
+		res.ConsensusNodes = append(res.ConsensusNodes, node)
+	}
+	for _, node := range b.syncNodes {
+		node.Network = b.network
+		res.SyncNodes = append(res.SyncNodes, node)
+	}
+	for _, node := range b.fileNodes {
+		node.Network = b.network
+		res.FileNodes = append(res.FileNodes, node)
+	}
+	for _, node := range b.namingNodes {
+		node.Network = b.network
+		res.NamingNodes = append(res.NamingNodes, node)
+	}
+	for _, node := range b.paymentNodes {
+		node.Network = b.network
+		res.PaymentNodes = append(res.PaymentNodes, node)
+	}
+	res.Configuration = b.network.Configuration(time.Now())
+	return
+}
+
+// Configuration converts the network to the nodeconf format
+func (n Network) Configuration(creationTime time.Time) nodeconf.Configuration {
+	conf := nodeconf.Configuration{
+		Id:           n.ID,
+		NetworkId:    n.NetworkID,
+		Nodes:        make([]nodeconf.Node, 0, len(n.Nodes)),
+		CreationTime: creationTime,
+	}
+	for _, node := range n.Nodes {
+		types := make([]nodeconf.NodeType, 0, len(node.Types))
+		for _, t := range node.Types {
+			types = append(types, nodeconf.NodeType(t))
+		}
+		conf.Nodes = append(conf.Nodes, nodeconf.Node{
+			PeerId:    node.PeerID,
+			Addresses: node.Addresses,
+			Types:     types,
+		})
+	}
+	return conf
+}
@@ -0,0 +1,45 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/anyproto/any-sync/util/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder_Build(t *testing.T) {
+	netKey, _, err := crypto.GenerateRandomEd25519KeyPair()
+	require.NoError(t, err)
+	b, err := New(WithNetworkKey(netKey), WithExternalAddresses("example.org"))
+	require.NoError(t, err)
+	assert.Equal(t, netKey.GetPublic().Network(), b.NetworkId())
+
+	sync, err := b.AddSyncNode(WithListen("0.0.0.0", 4430, 5430), WithExternalPorts(443, 1443))
+	require.NoError(t, err)
+	assert.Equal(t, sync.Account.PeerKey, sync.Account.SigningKey)
+
+	_, err = b.Build()
+	assert.ErrorIs(t, err, ErrNoCoordinator)
+	partial, err := b.BuildPartial()
+	require.NoError(t, err)
+	require.Len(t, partial.Configuration.Nodes, 1)
+	assert.Equal(t, []string{"0.0.0.0:4430", "quic://0.0.0.0:5430", "example.org:443", "quic://example.org:1443"}, partial.Configuration.Nodes[0].Addresses)
+
+	_, err = b.AddCoordinator()
+	assert.ErrorIs(t, err, ErrNoListenAddr)
+	coordinator, err := b.AddCoordinator(WithListen("0.0.0.0", 4830, 5830))
+	require.NoError(t, err)
+	encNetKey, err := crypto.EncodeKeyToString(netKey)
+	require.NoError(t, err)
+	assert.Equal(t, encNetKey, coordinator.Account.SigningKey)
+
+	res, err := b.Build()
+	require.NoError(t, err)
+	assert.Equal(t, b.NetworkId(), res.Configuration.NetworkId)
+	require.Len(t, res.Configuration.Nodes, 2)
+	assert.Equal(t, []nodeconf.NodeType{nodeconf.NodeTypeCoordinator}, res.Configuration.Nodes[1].Types)
+	// every node gets the complete network list
+	assert.Len(t, res.SyncNodes[0].Network.Nodes, 2)
+}
@@ -0,0 +1,235 @@
+package builder
+
+import (
+	"github.com/anyproto/any-sync/accountservice"
+)
+
+type GeneralNodeConfig struct {
+	Account          accountservice.Config `yaml:"account"`
+	Drpc             DrpcConfig            `yaml:"drpc"`
+	Yamux            TransportConfig       `yaml:"yamux"`
+	Quic             TransportConfig       `yaml:"quic"`
+	Network          Network               `yaml:"network"`
+	NetworkStorePath string                `yaml:"networkStorePath"`
+	Log              LogConfig             `yaml:"log"`
+	Metric           MetricConfig          `yaml:"metric"`
+}
+
+type DrpcConfig struct {
+	Snappy bool `yaml:"snappy"`
+	Stream struct {
+		MaxMsgSizeMb int `yaml:"maxMsgSizeMb"`
+	} `yaml:"stream"`
+}
+
+type TransportConfig struct {
+	ListenAddrs     []string `yaml:"listenAddrs"`
+	WriteTimeoutSec int      `yaml:"writeTimeoutSec"`
+	DialTimeoutSec  int      `yaml:"dialTimeoutSec"`
+}
+
+type LogConfig struct {
+	Production   bool   `yaml:"production"`
+	DefaultLevel string `yaml:"defaultLevel"`
+	NamedLevels  struct {
+	} `yaml:"namedLevels"`
+}
+
+type MetricConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+type CoordinatorNodeConfig struct {
+	GeneralNodeConfig `yaml:".,inline"`
+	Mongo             CoordinatorMongoConfig `yaml:"mongo"`
+	SpaceStatus       SpaceStatusConfig      `yaml:"spaceStatus"`
+	DefaultLimits     SpaceLimits            `yaml:"defaultLimits"`
+}
+
+type CoordinatorMongoConfig struct {
+	Connect  string `yaml:"connect"`
+	Database string `yaml:"database"`
+	Log      string `yaml:"log"`
+	Spaces   string `yaml:"spaces"`
+}
+
+type SpaceStatusConfig struct {
+	RunSeconds         int `yaml:"runSeconds"`
+	DeletionPeriodDays int `yaml:"deletionPeriodDays"`
+}
+
+type SpaceLimits struct {
+	SpaceMembersRead  int `yaml:"spaceMembersRead"`
+	SpaceMembersWrite int `yaml:"spaceMembersWrite"`
+	SharedSpacesLimit int `yaml:"sharedSpacesLimit"`
+}
+
+type ConsensusNodeConfig struct {
+	GeneralNodeConfig `yaml:".,inline"`
+	Mongo             ConsensusMongoConfig `yaml:"mongo"`
+}
+
+type ConsensusMongoConfig struct {
+	Connect       string `yaml:"connect"`
+	Database      string `yaml:"database"`
+	LogCollection string `yaml:"logCollection"`
+}
+
+type SyncNodeConfig struct {
+	GeneralNodeConfig `yaml:".,inline"`
+	Space             SpaceConfig     `yaml:"space"`
+	Storage           StorageConfig   `yaml:"storage"`
+	NodeSync          NodeSyncConfig  `yaml:"nodeSync"`
+	ApiServer         ApiServerConfig `yaml:"apiServer"`
+}
+
+type SpaceConfig struct {
+	GcTTL      int `yaml:"gcTTL"`
+	SyncPeriod int `yaml:"syncPeriod"`
+}
+
+type StorageConfig struct {
+	Path         string `yaml:"path"`
+	AnyStorePath string `yaml:"anyStorePath"`
+}
+
+type NodeSyncConfig struct {
+	SyncOnStart       bool `yaml:"syncOnStart"`
+	PeriodicSyncHours int  `yaml:"periodicSyncHours"`
+}
+
+type ApiServerConfig struct {
+	ListenAddr string `yaml:"listenAddr"`
+}
+
+type FileNodeConfig struct {
+	GeneralNodeConfig `yaml:".,inline"`
+	DefaultLimit      int           `yaml:"defaultLimit"`
+	S3Store           S3StoreConfig `yaml:"s3Store"`
+	Redis             RedisConfig   `yaml:"redis"`
+}
+
+type S3StoreConfig struct {
+	Endpoint       string        `yaml:"endpoint,omitempty"`
+	Bucket         string        `yaml:"bucket"`
+	IndexBucket    string        `yaml:"indexBucket"`
+	Region         string        `yaml:"region"`
+	Profile        string        `yaml:"profile,omitempty"`
+	MaxThreads     int           `yaml:"maxThreads"`
+	ForcePathStyle bool          `yaml:"forcePathStyle"`
+	Credentials    S3Credentials `yaml:"credentials,omitempty"`
+}
+
+// S3Credentials are static S3 keys. They are used instead of the AWS profile when set
+type S3Credentials struct {
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+}
+
+type RedisConfig struct {
+	IsCluster bool                 `yaml:"isCluster"`
+	URL       string               `yaml:"url,omitempty"`
+	Sentinel  *RedisSentinelConfig `yaml:"sentinel,omitempty"`
+}
+
+type RedisSentinelConfig struct {
+	MasterName string   `yaml:"masterName"`
+	Addrs      []string `yaml:"addrs"`
+	Password   string   `yaml:"password,omitempty"`
+}
+
+type Node struct {
+	PeerID    string   `yaml:"peerId"`
+	Addresses []string `yaml:"addresses"`
+	Types     []string `yaml:"types"`
+}
+
+type HeartConfig struct {
+	NetworkID string `yaml:"networkId"`
+	Nodes     []Node `yaml:"nodes"`
+}
+
+type Network struct {
+	ID          string `yaml:"id"`
+	HeartConfig `yaml:".,inline"`
+}
+
+func defaultGeneralNode() GeneralNodeConfig {
+	c := GeneralNodeConfig{
+		Drpc: DrpcConfig{
+			Snappy: true,
+		},
+		Yamux: TransportConfig{
+			WriteTimeoutSec: 10,
+			DialTimeoutSec:  10,
+		},
+		Quic: TransportConfig{
+			WriteTimeoutSec: 10,
+			DialTimeoutSec:  10,
+		},
+		NetworkStorePath: "/networkStore",
+		Log: LogConfig{
+			DefaultLevel: "info",
+		},
+		Metric: MetricConfig{
+			Addr: "0.0.0.0:8000",
+		},
+	}
+	c.Drpc.Stream.MaxMsgSizeMb = 256
+	return c
+}
+
+func defaultCoordinatorNode() CoordinatorNodeConfig {
+	return CoordinatorNodeConfig{
+		GeneralNodeConfig: defaultGeneralNode(),
+		Mongo: CoordinatorMongoConfig{
+			Log:    "log",
+			Spaces: "spaces",
+		},
+		SpaceStatus: SpaceStatusConfig{
+			RunSeconds:         5,
+			DeletionPeriodDays: 0,
+		},
+	}
+}
+
+func defaultConsensusNode() ConsensusNodeConfig {
+	return ConsensusNodeConfig{
+		GeneralNodeConfig: defaultGeneralNode(),
+		Mongo: ConsensusMongoConfig{
+			LogCollection: "log",
+		},
+	}
+}
+
+func defaultSyncNode() SyncNodeConfig {
+	return SyncNodeConfig{
+		GeneralNodeConfig: defaultGeneralNode(),
+		Space: SpaceConfig{
+			GcTTL:      60,
+			SyncPeriod: 600,
+		},
+		Storage: StorageConfig{
+			Path:         "/storage",
+			AnyStorePath: "/anyStorage",
+		},
+		NodeSync: NodeSyncConfig{
+			SyncOnStart:       true,
+			PeriodicSyncHours: 2,
+		},
+		ApiServer: ApiServerConfig{
+			ListenAddr: "0.0.0.0:8080",
+		},
+	}
+}
+
+func defaultFileNode() FileNodeConfig {
+	c := FileNodeConfig{
+		GeneralNodeConfig: defaultGeneralNode(),
+		S3Store: S3StoreConfig{
+			MaxThreads: 16,
+		},
+	}
+	c.Drpc.Snappy = false
+	return c
+}
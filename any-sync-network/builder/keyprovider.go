@@ -0,0 +1,214 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/anyproto/any-sync/util/crypto"
+	"github.com/kballard/go-shellquote"
+)
+
+// DefaultKeyProviderTimeout limits every call of an ExecKeyProvider, a signer may wait for a confirmation on the device
+const DefaultKeyProviderTimeout = time.Minute
+
+// KeyError is a failure of the key provider or of a key, the other errors of the builder are wrong parameters
+type KeyError struct {
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// Key is a key created by a KeyProvider
+type Key struct {
+	// Ref is written to the configs in place of the private key: the encoded private key itself
+	// for the in-process provider, a reference only the provider can resolve for an external one
+	Ref    string
+	PubKey crypto.PubKey
+}
+
+// KeyProvider creates the node and network keys. The configs get the references of the keys,
+// so with an external provider the private keys never exist where the configs are built
+type KeyProvider interface {
+	// GenerateKey creates a new ed25519 key
+	GenerateKey() (Key, error)
+	// PublicKey returns the public key the reference points to
+	PublicKey(ref string) (crypto.PubKey, error)
+	// Sign signs the data with the key the reference points to
+	Sign(ref string, data []byte) ([]byte, error)
+}
+
+// LocalKeyProvider generates the keys in process, the references are the encoded private keys
+type LocalKeyProvider struct{}
+
+// GenerateKey creates a random ed25519 key
+func (LocalKeyProvider) GenerateKey() (Key, error) {
+	privKey, _, err := crypto.GenerateRandomEd25519KeyPair()
+	if err != nil {
+		return Key{}, err
+	}
+	return LocalKey(privKey)
+}
+
+// PublicKey decodes the private key of the reference
+func (LocalKeyProvider) PublicKey(ref string) (crypto.PubKey, error) {
+	privKey, err := crypto.DecodeKeyFromString(ref, crypto.UnmarshalEd25519PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return privKey.GetPublic(), nil
+}
+
+// Sign decodes the private key of the reference and signs the data with it
+func (LocalKeyProvider) Sign(ref string, data []byte) ([]byte, error) {
+	privKey, err := crypto.DecodeKeyFromString(ref, crypto.UnmarshalEd25519PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return privKey.Sign(data)
+}
+
+// LocalKey returns the Key of an in-process private key
+func LocalKey(privKey crypto.PrivKey) (Key, error) {
+	encKey, err := crypto.EncodeKeyToString(privKey)
+	if err != nil {
+		return Key{}, &KeyError{Err: err}
+	}
+	return Key{Ref: encKey, PubKey: privKey.GetPublic()}, nil
+}
+
+// ExecKeyProvider delegates the keys to an external executable. Every call runs the command once,
+// writes one JSON request to its stdin and reads one JSON response from its stdout:
+//
+//	{"command": "generate"}                                    -> {"ref": "<reference>", "publicKey": "<base64 ed25519 public key>"}
+//	{"command": "publicKey", "ref": "..."}                     -> {"publicKey": "<base64 ed25519 public key>"}
+//	{"command": "sign", "ref": "...", "data": "<base64 data>"} -> {"signature": "<base64 signature>"}
+//
+// A failure is reported with {"error": "<message>"} or a non-zero exit code
+type ExecKeyProvider struct {
+	// Command is the executable with its arguments
+	Command []string
+	// Timeout limits every call, the process is killed when it expires
+	Timeout time.Duration
+}
+
+// NewExecKeyProvider creates a provider of the command line. It is split like a shell does,
+// so paths and arguments with spaces can be quoted
+func NewExecKeyProvider(commandLine string) (*ExecKeyProvider, error) {
+	command, err := shellquote.Split(commandLine)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key provider command: %w", err)
+	}
+	if len(command) == 0 {
+		return nil, errors.New("key provider command is empty")
+	}
+	return &ExecKeyProvider{Command: command, Timeout: DefaultKeyProviderTimeout}, nil
+}
+
+type keyProviderRequest struct {
+	Command string `json:"command"`
+	Ref     string `json:"ref,omitempty"`
+	Data    []byte `json:"data,omitempty"`
+}
+
+type keyProviderResponse struct {
+	Ref       string `json:"ref"`
+	PublicKey string `json:"publicKey"`
+	Signature []byte `json:"signature"`
+	Error     string `json:"error"`
+}
+
+// GenerateKey asks the provider for a new key
+func (p *ExecKeyProvider) GenerateKey() (Key, error) {
+	resp, err := p.call(keyProviderRequest{Command: "generate"})
+	if err != nil {
+		return Key{}, err
+	}
+	if resp.Ref == "" {
+		return Key{}, fmt.Errorf("key provider returned no key reference")
+	}
+	pubKey, err := decodePublicKey(resp.PublicKey)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Ref: resp.Ref, PubKey: pubKey}, nil
+}
+
+// PublicKey asks the provider for the public key of the reference
+func (p *ExecKeyProvider) PublicKey(ref string) (crypto.PubKey, error) {
+	resp, err := p.call(keyProviderRequest{Command: "publicKey", Ref: ref})
+	if err != nil {
+		return nil, err
+	}
+	return decodePublicKey(resp.PublicKey)
+}
+
+// Sign asks the provider to sign the data with the key of the reference
+func (p *ExecKeyProvider) Sign(ref string, data []byte) ([]byte, error) {
+	resp, err := p.call(keyProviderRequest{Command: "sign", Ref: ref, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Signature) == 0 {
+		return nil, fmt.Errorf("key provider returned no signature")
+	}
+	return resp.Signature, nil
+}
+
+func (p *ExecKeyProvider) call(req keyProviderRequest) (resp keyProviderResponse, err error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// the children of the provider may keep the pipes open after it is killed
+	cmd.WaitDelay = time.Second
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("timed out after %s: %w", p.Timeout, err)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return resp, fmt.Errorf("key provider %s failed: %w: %s", req.Command, err, msg)
+		}
+		return resp, fmt.Errorf("key provider %s failed: %w", req.Command, err)
+	}
+
+	if err = json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return resp, fmt.Errorf("key provider %s returned wrong response: %w", req.Command, err)
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("key provider %s failed: %s", req.Command, resp.Error)
+	}
+	return resp, nil
+}
+
+func decodePublicKey(encKey string) (crypto.PubKey, error) {
+	pubKey, err := crypto.DecodeKeyFromString(encKey, crypto.UnmarshalEd25519PublicKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("key provider returned wrong public key: %w", err)
+	}
+	return pubKey, nil
+}
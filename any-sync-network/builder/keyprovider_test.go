@@ -0,0 +1,51 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExecKeyProvider(t *testing.T) {
+	for _, tc := range []struct {
+		commandLine string
+		command     []string
+		err         bool
+	}{
+		{commandLine: "/usr/bin/provider", command: []string{"/usr/bin/provider"}},
+		{commandLine: "provider --slot 1", command: []string{"provider", "--slot", "1"}},
+		{commandLine: `"/opt/my signer/provider" --label 'node key'`, command: []string{"/opt/my signer/provider", "--label", "node key"}},
+		{commandLine: "  ", err: true},
+		{commandLine: `"unterminated`, err: true},
+	} {
+		t.Run(tc.commandLine, func(t *testing.T) {
+			p, err := NewExecKeyProvider(tc.commandLine)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.command, p.Command)
+		})
+	}
+}
+
+func TestLocalKeyProvider(t *testing.T) {
+	var keys LocalKeyProvider
+	key, err := keys.GenerateKey()
+	require.NoError(t, err)
+	pubKey, err := keys.PublicKey(key.Ref)
+	require.NoError(t, err)
+	assert.True(t, key.PubKey.Equals(pubKey))
+	sig, err := keys.Sign(key.Ref, []byte("data"))
+	require.NoError(t, err)
+	ok, err := pubKey.Verify([]byte("data"), sig)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = keys.PublicKey("not a key")
+	assert.Error(t, err)
+	_, err = keys.Sign("not a key", []byte("data"))
+	assert.Error(t, err)
+}
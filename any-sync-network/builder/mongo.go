@@ -0,0 +1,89 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MongoSettings describes the mongo replica set used by coordinator and consensus nodes
+type MongoSettings struct {
+	Hosts        []string `yaml:"hosts"`
+	ReplicaSet   string   `yaml:"replicaSet"`
+	AuthDatabase string   `yaml:"authDatabase"`
+	User         string   `yaml:"user"`
+	Password     string   `yaml:"password"`
+	WriteConcern string   `yaml:"writeConcern"`
+}
+
+// Validate checks that the settings describe a replica set
+func (m MongoSettings) Validate() error {
+	if len(m.Hosts) == 0 {
+		return errors.New("mongo hosts are not specified")
+	}
+	if m.ReplicaSet == "" {
+		return errors.New("mongo replica set name is not specified")
+	}
+	if m.Password != "" && m.User == "" {
+		return errors.New("mongo password is set without a user")
+	}
+	return nil
+}
+
+// URI returns the connect string of the replica set
+func (m MongoSettings) URI() (string, error) {
+	if err := m.Validate(); err != nil {
+		return "", err
+	}
+	u := url.URL{
+		Scheme: "mongodb",
+		Host:   strings.Join(m.Hosts, ","),
+		Path:   "/",
+	}
+	if m.User != "" {
+		u.User = url.UserPassword(m.User, m.Password)
+	}
+	q := url.Values{}
+	q.Set("replicaSet", m.ReplicaSet)
+	if m.AuthDatabase != "" {
+		q.Set("authSource", m.AuthDatabase)
+	}
+	if m.WriteConcern != "" {
+		q.Set("w", m.WriteConcern)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// InitScript returns a mongosh script that initiates the replica set and creates the user with access to the databases.
+// The password is asked by mongosh, so it isn't written to the script
+func (m MongoSettings) InitScript(databases ...string) (string, error) {
+	if err := m.Validate(); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("// Initiates the MongoDB replica set used by any-sync-coordinator and any-sync-consensusnode\n")
+	fmt.Fprintf(&b, "// Run it once with: mongosh \"mongodb://%s\" mongo-init.js\n", m.Hosts[0])
+	fmt.Fprintf(&b, "rs.initiate({\n  _id: %q,\n  members: [\n", m.ReplicaSet)
+	for i, host := range m.Hosts {
+		fmt.Fprintf(&b, "    { _id: %d, host: %q },\n", i, host)
+	}
+	b.WriteString("  ]\n});\n")
+	if m.User == "" {
+		return b.String(), nil
+	}
+
+	authDatabase := m.AuthDatabase
+	if authDatabase == "" {
+		authDatabase = "admin"
+	}
+	b.WriteString("\n// wait for the primary to be elected\n")
+	b.WriteString("while (!db.hello().isWritablePrimary) {\n  sleep(1000);\n}\n\n")
+	fmt.Fprintf(&b, "db.getSiblingDB(%q).createUser({\n  user: %q,\n  pwd: passwordPrompt(),\n  roles: [\n", authDatabase, m.User)
+	for _, database := range databases {
+		fmt.Fprintf(&b, "    { role: \"readWrite\", db: %q },\n", database)
+	}
+	b.WriteString("  ]\n});\n")
+	return b.String(), nil
+}
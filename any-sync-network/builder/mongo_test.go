@@ -0,0 +1,76 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMongoSettings_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		settings MongoSettings
+		err      string
+	}{
+		{"ok", MongoSettings{Hosts: []string{"m1:27017"}, ReplicaSet: "rs0"}, ""},
+		{"ok with auth", MongoSettings{Hosts: []string{"m1:27017"}, ReplicaSet: "rs0", User: "any", Password: "secret"}, ""},
+		{"no hosts", MongoSettings{ReplicaSet: "rs0"}, "mongo hosts are not specified"},
+		{"no replica set", MongoSettings{Hosts: []string{"m1:27017"}}, "mongo replica set name is not specified"},
+		{"password without user", MongoSettings{Hosts: []string{"m1:27017"}, ReplicaSet: "rs0", Password: "secret"}, "mongo password is set without a user"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.settings.Validate()
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestMongoSettings_URI(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		settings MongoSettings
+		uri      string
+	}{
+		{
+			name:     "hosts only",
+			settings: MongoSettings{Hosts: []string{"m1:27017", "m2:27017"}, ReplicaSet: "rs0"},
+			uri:      "mongodb://m1:27017,m2:27017/?replicaSet=rs0",
+		},
+		{
+			name: "auth and write concern",
+			settings: MongoSettings{
+				Hosts:        []string{"m1:27017"},
+				ReplicaSet:   "rs0",
+				AuthDatabase: "admin",
+				User:         "any",
+				Password:     "p@ss/word",
+				WriteConcern: "majority",
+			},
+			uri: "mongodb://any:p%40ss%2Fword@m1:27017/?authSource=admin&replicaSet=rs0&w=majority",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			uri, err := tc.settings.URI()
+			require.NoError(t, err)
+			assert.Equal(t, tc.uri, uri)
+		})
+	}
+
+	_, err := MongoSettings{}.URI()
+	assert.Error(t, err)
+}
+
+func TestMongoSettings_InitScript(t *testing.T) {
+	settings := MongoSettings{Hosts: []string{"m1:27017", "m2:27017"}, ReplicaSet: "rs0", User: "any", Password: "secret"}
+	script, err := settings.InitScript("coordinator", "consensus")
+	require.NoError(t, err)
+	assert.Contains(t, script, `{ _id: 1, host: "m2:27017" }`)
+	assert.Contains(t, script, `db.getSiblingDB("admin").createUser`)
+	assert.Contains(t, script, `{ role: "readWrite", db: "consensus" }`)
+	assert.NotContains(t, script, "secret")
+}
@@ -0,0 +1,65 @@
+package builder
+
+import (
+	"fmt"
+)
+
+// State is a serializable snapshot of a Builder. It contains private keys,
+// or only their references if the keys are kept by an external key provider
+type State struct {
+	NetworkKey        string                  `yaml:"networkKey"`
+	Network           Network                 `yaml:"network"`
+	ExternalAddresses []string                `yaml:"externalAddresses"`
+	Coordinators      []CoordinatorNodeConfig `yaml:"coordinators"`
+	ConsensusNodes    []ConsensusNodeConfig   `yaml:"consensusNodes"`
+	SyncNodes         []SyncNodeConfig        `yaml:"syncNodes"`
+	FileNodes         []FileNodeConfig        `yaml:"fileNodes"`
+	NamingNodes       []GeneralNodeConfig     `yaml:"namingNodes,omitempty"`
+	PaymentNodes      []GeneralNodeConfig     `yaml:"paymentProcessingNodes,omitempty"`
+}
+
+// State returns the snapshot of the builder
+func (b *Builder) State() (State, error) {
+	return State{
+		NetworkKey:        b.netKey.Ref,
+		Network:           b.network,
+		ExternalAddresses: b.externalAddrs,
+		Coordinators:      b.coordinators,
+		ConsensusNodes:    b.consensus,
+		SyncNodes:         b.syncNodes,
+		FileNodes:         b.fileNodes,
+		NamingNodes:       b.namingNodes,
+		PaymentNodes:      b.paymentNodes,
+	}, nil
+}
+
+// Restore creates a Builder from the snapshot. The snapshot of a builder with an external key provider
+// should be restored with WithKeyProvider of the same provider
+func Restore(s State, opts ...Option) (*Builder, error) {
+	b := &Builder{}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.keys == nil {
+		b.keys = LocalKeyProvider{}
+	}
+	netPubKey, err := b.keys.PublicKey(s.NetworkKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode network key: %w", err)
+	}
+	if netPubKey.Network() != s.Network.NetworkID {
+		return nil, fmt.Errorf("network key doesn't match network id %s", s.Network.NetworkID)
+	}
+	return &Builder{
+		keys:          b.keys,
+		netKey:        Key{Ref: s.NetworkKey, PubKey: netPubKey},
+		network:       s.Network,
+		externalAddrs: s.ExternalAddresses,
+		coordinators:  s.Coordinators,
+		consensus:     s.ConsensusNodes,
+		syncNodes:     s.SyncNodes,
+		fileNodes:     s.FileNodes,
+		namingNodes:   s.NamingNodes,
+		paymentNodes:  s.PaymentNodes,
+	}, nil
+}
@@ -0,0 +1,52 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRestore(t *testing.T) {
+	b, err := New(WithExternalAddresses("example.org"))
+	require.NoError(t, err)
+	_, err = b.AddCoordinator(WithListen("127.0.0.1", 4830, 5830), WithMongo("mongodb://localhost:27017", "coordinator"))
+	require.NoError(t, err)
+	_, err = b.AddSyncNode(WithListen("127.0.0.1", 4430, 5430))
+	require.NoError(t, err)
+
+	state, err := b.State()
+	require.NoError(t, err)
+	data, err := yaml.Marshal(state)
+	require.NoError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		var restoredState State
+		require.NoError(t, yaml.Unmarshal(data, &restoredState))
+		restored, err := Restore(restoredState)
+		require.NoError(t, err)
+		assert.Equal(t, b.NetworkId(), restored.NetworkId())
+
+		res, err := restored.Build()
+		require.NoError(t, err)
+		require.Len(t, res.Coordinators, 1)
+		require.Len(t, res.SyncNodes, 1)
+		assert.Equal(t, state.NetworkKey, res.Coordinators[0].Account.SigningKey)
+		assert.Len(t, res.Configuration.Nodes, 2)
+	})
+	t.Run("wrong network id", func(t *testing.T) {
+		other, err := New()
+		require.NoError(t, err)
+		wrongState := state
+		wrongState.Network.NetworkID = other.NetworkId()
+		_, err = Restore(wrongState)
+		assert.ErrorContains(t, err, "network key doesn't match")
+	})
+	t.Run("wrong network key", func(t *testing.T) {
+		wrongState := state
+		wrongState.NetworkKey = "not a key"
+		_, err := Restore(wrongState)
+		assert.ErrorContains(t, err, "can't decode network key")
+	})
+}
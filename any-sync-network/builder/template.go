@@ -0,0 +1,125 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/anyproto/any-sync/accountservice"
+	"github.com/anyproto/any-sync/nodeconf"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateData is the data model available in user-provided node config templates
+type TemplateData struct {
+	// Account is the node account with the private keys
+	Account accountservice.Config
+	// Addresses are the addresses of the node in the network list
+	Addresses []string
+	// ListenAddrs are the yamux and quic addresses the node listens on
+	ListenAddrs struct {
+		Yamux []string
+		Quic  []string
+	}
+	// Type is the first node type, Types are all of them
+	Type  string
+	Types []string
+	// Network is the complete network list
+	Network Network
+	// Config is the config the tool would write without a template
+	Config any
+	// Values are the values of the tool template file
+	Values map[string]any
+}
+
+var templateFuncs = template.FuncMap{
+	"toYaml": func(v any) (string, error) {
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(string(data), "\n"), nil
+	},
+	"indent": func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+}
+
+// ParseTemplate parses a node config template.
+// Besides the standard functions, templates can use `toYaml` and `indent`
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// LoadTemplate reads and parses a node config template file
+func LoadTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTemplate(path, string(data))
+}
+
+// NewTemplateData collects the template data of a node. The node must be a part of the network
+func NewTemplateData(account accountservice.Config, network Network, config any, values map[string]any) TemplateData {
+	data := TemplateData{
+		Account: account,
+		Network: network,
+		Config:  config,
+		Values:  values,
+	}
+	for _, n := range network.Nodes {
+		if n.PeerID == account.PeerId {
+			data.Addresses = n.Addresses
+			data.Types = n.Types
+			break
+		}
+	}
+	if len(data.Types) > 0 {
+		data.Type = data.Types[0]
+	}
+	return data
+}
+
+// TemplateData collects the template data of the node config
+func (c GeneralNodeConfig) TemplateData(config any, values map[string]any) TemplateData {
+	data := NewTemplateData(c.Account, c.Network, config, values)
+	data.ListenAddrs.Yamux = c.Yamux.ListenAddrs
+	data.ListenAddrs.Quic = c.Quic.ListenAddrs
+	return data
+}
+
+// Render executes the template with the data
+func Render(tmpl *template.Template, data TemplateData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("can't render the template for %s: %w", data.Account.PeerId, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// NetworkFromConfiguration converts the nodeconf format to the network list
+func NetworkFromConfiguration(conf nodeconf.Configuration) Network {
+	network := Network{
+		ID: conf.Id,
+		HeartConfig: HeartConfig{
+			NetworkID: conf.NetworkId,
+			Nodes:     make([]Node, 0, len(conf.Nodes)),
+		},
+	}
+	for _, n := range conf.Nodes {
+		types := make([]string, 0, len(n.Types))
+		for _, t := range n.Types {
+			types = append(types, string(t))
+		}
+		network.Nodes = append(network.Nodes, Node{
+			PeerID:    n.PeerId,
+			Addresses: n.Addresses,
+			Types:     types,
+		})
+	}
+	return network
+}
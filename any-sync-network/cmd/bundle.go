@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
+	"github.com/anyproto/any-sync/util/crypto"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	manifestName  = "manifest.yml"
+	signatureName = "manifest.sig"
+)
+
+// Manifest describes every file of a bundle. It is signed with the network key
+type Manifest struct {
+	NetworkId    string         `yaml:"networkId"`
+	CreationTime time.Time      `yaml:"creationTime"`
+	Files        []ManifestFile `yaml:"files"`
+}
+
+type ManifestFile struct {
+	Path     string `yaml:"path"`
+	SHA256   string `yaml:"sha256"`
+	NodeType string `yaml:"nodeType,omitempty"`
+	PeerId   string `yaml:"peerId,omitempty"`
+}
+
+var bundleDir string
+var bundlePath string
+var networkKeyPath string
+var expectedNetworkId string
+
+var bundle = &cobra.Command{
+	Use:          "bundle",
+	Short:        "Packages generated configs into a signed archive",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, netKey, err := loadBundleNetworkKey()
+		if err != nil {
+			return err
+		}
+
+		manifest, files, err := collectBundleFiles(bundleDir)
+		if err != nil {
+			return err
+		}
+		manifest.NetworkId = netKey.PubKey.Network()
+		manifest.CreationTime = time.Now().UTC()
+
+		manifestBytes, err := yaml.Marshal(manifest)
+		if err != nil {
+			return fmt.Errorf("could not marshal the manifest: %w", err)
+		}
+		sig, err := keys.Sign(netKey.Ref, manifestBytes)
+		if err != nil {
+			return fmt.Errorf("could not sign the manifest: %w", err)
+		}
+		// an external provider may sign with another key than the reference claims
+		if ok, _ := netKey.PubKey.Verify(manifestBytes, sig); !ok {
+			return errors.New("the manifest signature doesn't match the network key")
+		}
+
+		if err = writeBundle(bundlePath, manifestBytes, []byte(base64.StdEncoding.EncodeToString(sig)), files); err != nil {
+			return err
+		}
+
+		fmt.Printf("Bundle created: %s\n", bundlePath)
+		fmt.Println("\033[1m  Network ID:\033[0m", manifest.NetworkId)
+		fmt.Printf("  Files: %d\n", len(manifest.Files))
+		return nil
+	},
+}
+
+var verifyBundle = &cobra.Command{
+	Use:          "verify-bundle",
+	Short:        "Checks the signature and the checksums of a bundle",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifest, problems, err := checkBundle(bundlePath, expectedNetworkId)
+		if err != nil {
+			return err
+		}
+		fmt.Println("\033[1m  Network ID:\033[0m", manifest.NetworkId)
+		fmt.Printf("  Files: %d\n", len(manifest.Files))
+		for _, problem := range problems {
+			fmt.Println("  " + problem)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("bundle verification failed: %d problem(s)", len(problems))
+		}
+		fmt.Println("Bundle is valid")
+		return nil
+	},
+}
+
+// loadBundleNetworkKey reads the network key from the key file or from the coordinator config.
+// The signing key of the coordinator is a reference of --key-provider if it is set
+func loadBundleNetworkKey() (keys builder.KeyProvider, netKey builder.Key, err error) {
+	keys = builder.LocalKeyProvider{}
+	if networkKeyPath != "" {
+		data, err := os.ReadFile(networkKeyPath)
+		if err != nil {
+			return nil, netKey, fmt.Errorf("could not read the network key: %w", err)
+		}
+		privKey, err := crypto.DecodeKeyFromString(string(bytes.TrimSpace(data)), crypto.UnmarshalEd25519PrivateKey, nil)
+		if err != nil {
+			return nil, netKey, fmt.Errorf("could not decode the network key: %w", err)
+		}
+		netKey, err = builder.LocalKey(privKey)
+		return keys, netKey, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(bundleDir, "any-sync-coordinator", "config.yml"))
+	if err != nil {
+		return nil, netKey, fmt.Errorf("could not read the coordinator config, use --network-key: %w", err)
+	}
+	var coordinator builder.CoordinatorNodeConfig
+	if err = yaml.Unmarshal(data, &coordinator); err != nil {
+		return nil, netKey, fmt.Errorf("the coordinator config structure is wrong: %w", err)
+	}
+	if keyProviderCommand != "" {
+		if keys, err = builder.NewExecKeyProvider(keyProviderCommand); err != nil {
+			return nil, netKey, err
+		}
+	}
+	netKey.Ref = coordinator.Account.SigningKey
+	if netKey.PubKey, err = keys.PublicKey(netKey.Ref); err != nil {
+		return nil, netKey, fmt.Errorf("could not get the network key, use --key-provider if it is kept by a key provider: %w", err)
+	}
+	if netKey.PubKey.Network() != coordinator.Network.NetworkID {
+		return nil, netKey, fmt.Errorf("the coordinator signing key doesn't match network id %s", coordinator.Network.NetworkID)
+	}
+	return keys, netKey, nil
+}
+
+// collectBundleFiles reads all files of the directory and describes them in the manifest
+func collectBundleFiles(dir string) (manifest Manifest, files map[string][]byte, err error) {
+	files = map[string][]byte{}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name := path.Join("etc", filepath.ToSlash(rel))
+		files[name] = data
+		manifest.Files = append(manifest.Files, describeBundleFile(name, data))
+		return nil
+	})
+	if err != nil {
+		return manifest, nil, fmt.Errorf("could not read %s: %w", dir, err)
+	}
+	if len(files) == 0 {
+		return manifest, nil, fmt.Errorf("no files found in %s", dir)
+	}
+	return
+}
+
+func describeBundleFile(name string, data []byte) ManifestFile {
+	sum := sha256.Sum256(data)
+	file := ManifestFile{
+		Path:   name,
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+
+	// node configs contain the account and the network list with the node types
+	var nodeConfig builder.GeneralNodeConfig
+	if yaml.Unmarshal(data, &nodeConfig) != nil || nodeConfig.Account.PeerId == "" {
+		return file
+	}
+	file.PeerId = nodeConfig.Account.PeerId
+	for _, node := range nodeConfig.Network.Nodes {
+		if node.PeerID == file.PeerId && len(node.Types) > 0 {
+			file.NodeType = node.Types[0]
+		}
+	}
+	return file
+}
+
+func writeBundle(bundlePath string, manifest, sig []byte, files map[string][]byte) (err error) {
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		return fmt.Errorf("could not create the bundle: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := append([]string{manifestName, signatureName}, names...)
+	for _, name := range entries {
+		var data []byte
+		switch name {
+		case manifestName:
+			data = manifest
+		case signatureName:
+			data = sig
+		default:
+			data = files[name]
+		}
+		if err = tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}); err != nil {
+			return fmt.Errorf("could not write the bundle: %w", err)
+		}
+		if _, err = tw.Write(data); err != nil {
+			return fmt.Errorf("could not write the bundle: %w", err)
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("could not write the bundle: %w", err)
+	}
+	return gw.Close()
+}
+
+// readBundle returns the content of all bundle entries
+func readBundle(bundlePath string) (map[string][]byte, error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the bundle: %w", err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("the bundle is not a gzip archive: %w", err)
+	}
+	tr := tar.NewReader(gr)
+
+	entries := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read the bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the bundle: %w", err)
+		}
+		entries[hdr.Name] = data
+	}
+	return entries, nil
+}
+
+// checkBundle verifies the manifest signature and the files against the manifest.
+// The network id must come from a trusted source: anyone can sign a bundle for the network id of its own key.
+// It returns an error if the bundle can't be checked at all and the list of found problems otherwise
+func checkBundle(bundlePath, networkId string) (manifest Manifest, problems []string, err error) {
+	if networkId == "" {
+		return manifest, nil, errors.New("the expected network id is not set")
+	}
+	entries, err := readBundle(bundlePath)
+	if err != nil {
+		return
+	}
+
+	manifestBytes, ok := entries[manifestName]
+	if !ok {
+		return manifest, nil, fmt.Errorf("the bundle has no %s", manifestName)
+	}
+	if err = yaml.Unmarshal(manifestBytes, &manifest); err != nil {
+		return manifest, nil, fmt.Errorf("the manifest structure is wrong: %w", err)
+	}
+
+	if networkId != manifest.NetworkId {
+		problems = append(problems, fmt.Sprintf("the bundle is made for network %s", manifest.NetworkId))
+	}
+	pubKey, err := crypto.DecodeNetworkId(networkId)
+	if err != nil {
+		return manifest, nil, fmt.Errorf("wrong network id %s: %w", networkId, err)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(string(entries[signatureName]))
+	if err != nil || len(sig) == 0 {
+		problems = append(problems, "the manifest signature is missing or malformed")
+	} else if ok, _ := pubKey.Verify(manifestBytes, sig); !ok {
+		problems = append(problems, "the manifest signature is invalid")
+	}
+
+	listed := map[string]bool{}
+	for _, file := range manifest.Files {
+		listed[file.Path] = true
+		data, ok := entries[file.Path]
+		if !ok {
+			problems = append(problems, "missing file: "+file.Path)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != file.SHA256 {
+			problems = append(problems, "checksum mismatch: "+file.Path)
+		}
+	}
+	for name := range entries {
+		if name != manifestName && name != signatureName && !listed[name] {
+			problems = append(problems, "unexpected file: "+name)
+		}
+	}
+	sort.Strings(problems)
+	return manifest, problems, nil
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/anyproto/any-sync/util/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// writeTestBundle signs the manifest of the files with the key, the manifest can be changed before signing
+func writeTestBundle(t *testing.T, key crypto.PrivKey, files map[string][]byte, change func(m *Manifest)) string {
+	var manifest Manifest
+	for name, data := range files {
+		manifest.Files = append(manifest.Files, describeBundleFile(name, data))
+	}
+	manifest.NetworkId = key.GetPublic().Network()
+	if change != nil {
+		change(&manifest)
+	}
+	manifestBytes, err := yaml.Marshal(manifest)
+	require.NoError(t, err)
+	sig, err := key.Sign(manifestBytes)
+	require.NoError(t, err)
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	require.NoError(t, writeBundle(bundlePath, manifestBytes, []byte(base64.StdEncoding.EncodeToString(sig)), files))
+	return bundlePath
+}
+
+func TestCheckBundle(t *testing.T) {
+	netKey, _, err := crypto.GenerateRandomEd25519KeyPair()
+	require.NoError(t, err)
+	otherKey, _, err := crypto.GenerateRandomEd25519KeyPair()
+	require.NoError(t, err)
+	networkId := netKey.GetPublic().Network()
+	files := map[string][]byte{
+		"etc/client.yml":                      []byte("networkId: " + networkId + "\n"),
+		"etc/any-sync-coordinator/config.yml": []byte("account: {}\n"),
+		"etc/any-sync-node-1/config.yml":      []byte("account: {}\n"),
+	}
+
+	for _, tc := range []struct {
+		name   string
+		key    crypto.PrivKey
+		change func(m *Manifest)
+		// problems gets the path of the first file of the manifest
+		problems func(first string) []string
+	}{
+		{name: "valid", key: netKey},
+		{
+			name: "signed by another network",
+			key:  otherKey,
+			problems: func(string) []string {
+				return []string{"the bundle is made for network " + otherKey.GetPublic().Network(), "the manifest signature is invalid"}
+			},
+		},
+		{
+			name: "manifest of another network id",
+			key:  otherKey,
+			change: func(m *Manifest) {
+				m.NetworkId = networkId
+			},
+			problems: func(string) []string {
+				return []string{"the manifest signature is invalid"}
+			},
+		},
+		{
+			name: "changed file",
+			key:  netKey,
+			change: func(m *Manifest) {
+				m.Files[0].SHA256 = "00"
+			},
+			problems: func(first string) []string {
+				return []string{"checksum mismatch: " + first}
+			},
+		},
+		{
+			name: "missing file",
+			key:  netKey,
+			change: func(m *Manifest) {
+				m.Files = append(m.Files, ManifestFile{Path: "etc/missing.yml"})
+			},
+			problems: func(string) []string {
+				return []string{"missing file: etc/missing.yml"}
+			},
+		},
+		{
+			name: "unexpected file",
+			key:  netKey,
+			change: func(m *Manifest) {
+				m.Files = m.Files[1:]
+			},
+			problems: func(first string) []string {
+				return []string{"unexpected file: " + first}
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var first string
+			bundlePath := writeTestBundle(t, tc.key, files, func(m *Manifest) {
+				first = m.Files[0].Path
+				if tc.change != nil {
+					tc.change(m)
+				}
+			})
+			var problems []string
+			if tc.problems != nil {
+				problems = tc.problems(first)
+			}
+
+			_, found, err := checkBundle(bundlePath, networkId)
+			require.NoError(t, err)
+			assert.Equal(t, problems, found)
+		})
+	}
+
+	t.Run("no network id", func(t *testing.T) {
+		_, _, err := checkBundle(writeTestBundle(t, otherKey, files, nil), "")
+		assert.Error(t, err)
+	})
+}
@@ -5,130 +5,22 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"text/template"
 
 	"github.com/AlecAivazis/survey/v2"
-	"github.com/anyproto/any-sync/accountservice"
-	"github.com/anyproto/any-sync/util/crypto"
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
+	"github.com/anyproto/any-sync/nodeconf"
 	"github.com/spf13/cobra"
-	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/yaml.v3"
 )
 
-type GeneralNodeConfig struct {
-	Account accountservice.Config `yaml:"account"`
-	Drpc    struct {
-		Snappy bool `yaml:"snappy"`
-		Stream struct {
-			MaxMsgSizeMb int `yaml:"maxMsgSizeMb"`
-		} `yaml:"stream"`
-	} `yaml:"drpc"`
-	Yamux struct {
-		ListenAddrs     []string `yaml:"listenAddrs"`
-		WriteTimeoutSec int      `yaml:"writeTimeoutSec"`
-		DialTimeoutSec  int      `yaml:"dialTimeoutSec"`
-	} `yaml:"yamux"`
-	Quic struct {
-		ListenAddrs     []string `yaml:"listenAddrs"`
-		WriteTimeoutSec int      `yaml:"writeTimeoutSec"`
-		DialTimeoutSec  int      `yaml:"dialTimeoutSec"`
-	} `yaml:"quic"`
-	Network          Network `yaml:"network"`
-	NetworkStorePath string  `yaml:"networkStorePath"`
-	Log              struct {
-		Production   bool   `yaml:"production"`
-		DefaultLevel string `yaml:"defaultLevel"`
-		NamedLevels  struct {
-		} `yaml:"namedLevels"`
-	} `yaml:"log"`
-	Metric struct {
-		Addr string `yaml:"addr"`
-	} `yaml:"metric"`
-}
-
-type CoordinatorNodeConfig struct {
-	GeneralNodeConfig `yaml:".,inline"`
-	Mongo             struct {
-		Connect  string `yaml:"connect"`
-		Database string `yaml:"database"`
-		Log      string `yaml:"log"`
-		Spaces   string `yaml:"spaces"`
-	} `yaml:"mongo"`
-	SpaceStatus struct {
-		RunSeconds         int `yaml:"runSeconds"`
-		DeletionPeriodDays int `yaml:"deletionPeriodDays"`
-	} `yaml:"spaceStatus"`
-	DefaultLimits struct {
-		SpaceMembersRead  int `yaml:"spaceMembersRead"`
-		SpaceMembersWrite int `yaml:"spaceMembersWrite"`
-		SharedSpacesLimit int `yaml:"sharedSpacesLimit"`
-	} `yaml:"defaultLimits"`
-}
-
-type ConsensusNodeConfig struct {
-	GeneralNodeConfig `yaml:".,inline"`
-	Mongo             struct {
-		Connect       string `yaml:"connect"`
-		Database      string `yaml:"database"`
-		LogCollection string `yaml:"logCollection"`
-	} `yaml:"mongo"`
-}
-
-type SyncNodeConfig struct {
-	GeneralNodeConfig `yaml:".,inline"`
-	Space             struct {
-		GcTTL      int `yaml:"gcTTL"`
-		SyncPeriod int `yaml:"syncPeriod"`
-	} `yaml:"space"`
-	Storage struct {
-		Path string `yaml:"path"`
-		AnyStorePath string `yaml:"anyStorePath"`
-	} `yaml:"storage"`
-	NodeSync struct {
-		SyncOnStart       bool `yaml:"syncOnStart"`
-		PeriodicSyncHours int  `yaml:"periodicSyncHours"`
-	} `yaml:"nodeSync"`
-	ApiServer struct {
-		ListenAddr string `yaml:"listenAddr"`
-	} `yaml:"apiServer"`
-}
-
-type FileNodeConfig struct {
-	GeneralNodeConfig `yaml:".,inline"`
-	DefaultLimit      int `yaml:"defaultLimit"`
-	S3Store           struct {
-		Endpoint       string `yaml:"endpoint,omitempty"`
-		Bucket         string `yaml:"bucket"`
-		IndexBucket    string `yaml:"indexBucket"`
-		Region         string `yaml:"region"`
-		Profile        string `yaml:"profile"`
-		MaxThreads     int    `yaml:"maxThreads"`
-		ForcePathStyle bool   `yaml:"forcePathStyle"`
-	} `yaml:"s3Store"`
-	Redis struct {
-		IsCluster bool   `yaml:"isCluster"`
-		URL       string `yaml:"url"`
-	} `yaml:"redis"`
-}
-
-type Node struct {
-	PeerID    string   `yaml:"peerId"`
-	Addresses []string `yaml:"addresses"`
-	Types     []string `yaml:"types"`
-}
-
-type HeartConfig struct {
-	NetworkID string `yaml:"networkId"`
-	Nodes     []Node `yaml:"nodes"`
-}
-
-type Network struct {
-	ID          string `yaml:"id"`
-	HeartConfig `yaml:".,inline"`
-}
-
 type DefaultConfig struct {
 	ExternalAddr []string `yaml:"external-addresses"`
 
+	// Mongo is the replica set shared by coordinator and consensus nodes, the connect strings of the nodes are used when it has no hosts
+	Mongo builder.MongoSettings `yaml:"mongo"`
+
 	AnySyncCoordinator struct {
 		ListenAddr string `yaml:"listen"`
 		YamuxPort  int    `yaml:"yamuxPort"`
@@ -155,6 +47,8 @@ type DefaultConfig struct {
 	} `yaml:"any-sync-consensusnode"`
 
 	AnySyncFilenode struct {
+		// Count is the number of file nodes created with --auto, every next node gets the next ports
+		Count      int    `yaml:"count,omitempty"`
 		ListenAddr string `yaml:"listen"`
 		YamuxPort  int    `yaml:"yamuxPort"`
 		QuicPort   int    `yaml:"quicPort"`
@@ -164,10 +58,21 @@ type DefaultConfig struct {
 			IndexBucket    string `yaml:"indexBucket"`
 			Region         string `yaml:"region"`
 			Profile        string `yaml:"profile"`
+			MaxThreads     int    `yaml:"maxThreads"`
 			ForcePathStyle bool   `yaml:"forcePathStyle"`
+			Credentials    struct {
+				AccessKey string `yaml:"accessKey"`
+				SecretKey string `yaml:"secretKey"`
+			} `yaml:"credentials"`
 		} `yaml:"s3Store"`
 		Redis struct {
-			URL string `yaml:"url"`
+			URL       string `yaml:"url"`
+			IsCluster bool   `yaml:"isCluster"`
+			Sentinel  struct {
+				MasterName string   `yaml:"masterName"`
+				Addrs      []string `yaml:"addrs"`
+				Password   string   `yaml:"password"`
+			} `yaml:"sentinel"`
 		} `yaml:"redis"`
 		DefaultLimit int `yaml:"defaultLimit"`
 	} `yaml:"any-sync-filenode"`
@@ -177,6 +82,16 @@ type DefaultConfig struct {
 		YamuxPort  []int    `yaml:"yamuxPort"`
 		QuicPort   []int    `yaml:"quicPort"`
 	} `yaml:"any-sync-node"`
+
+	AnySyncNamingNode            ServiceNodeTemplate `yaml:"any-sync-namingnode"`
+	AnySyncPaymentProcessingNode ServiceNodeTemplate `yaml:"any-sync-paymentprocessingnode"`
+}
+
+// ServiceNodeTemplate describes an optional node of the network. With --auto it is created only if the listen address is set
+type ServiceNodeTemplate struct {
+	ListenAddr string `yaml:"listen"`
+	YamuxPort  int    `yaml:"yamuxPort"`
+	QuicPort   int    `yaml:"quicPort"`
 }
 
 func loadDefaultTemplate() {
@@ -189,275 +104,432 @@ func loadDefaultTemplate() {
 	if err != nil {
 		panic(err)
 	}
+
+	err = yaml.Unmarshal(data, &templateValues)
+	if err != nil {
+		panic(err)
+	}
 }
 
 var cfg DefaultConfig
 
+// templateValues are all the values of the template file, including the ones DefaultConfig doesn't know about
+var templateValues map[string]any
+
 var create = &cobra.Command{
 	Use:   "create",
 	Short: "Creates new network configuration",
 	Run: func(cmd *cobra.Command, args []string) {
-		// Create Network
-		fmt.Println("Creating network...")
-		netKey, _, _ := crypto.GenerateRandomEd25519KeyPair()
-		network = Network{
-			HeartConfig: HeartConfig{
-				Nodes: []Node{},
-			},
+		if resumeFlag {
+			if err := loadSession(cmd.Flags().Changed("auto")); err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			fmt.Println("Resuming network creation...")
+			fmt.Println("\033[1m  Network ID:\033[0m", bld.NetworkId())
+		} else {
+			if _, err := os.Stat(sessionPath); err == nil {
+				fmt.Printf("Unfinished session found in %s, use --resume to continue it or remove the file to start over\n", sessionPath)
+				return
+			}
+
+			// Create Network
+			fmt.Println("Creating network...")
+			loadDefaultTemplate()
+
+			keyOpts, err := keyProviderOptions()
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			if bld, err = builder.New(append(keyOpts, builder.WithExternalAddresses(cfg.ExternalAddr...))...); err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+
+			fmt.Println("\033[1m  Network ID:\033[0m", bld.NetworkId())
+
+			step = stepCoordinator
+			if err := saveSession(); err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+		}
+
+		for step != stepDone {
+			if err := runStep(step); err != nil {
+				fmt.Println(err.Error())
+				fmt.Printf("Progress is saved to %s, run `create --resume` to continue\n", sessionPath)
+				return
+			}
+			step = nextStep(step)
+			if step == stepDone {
+				break
+			}
+			if err := saveSession(); err != nil {
+				fmt.Println(err.Error())
+				return
+			}
 		}
-		network.ID = bson.NewObjectId().Hex()
-		network.NetworkID = netKey.GetPublic().Network()
 
-		fmt.Println("\033[1m  Network ID:\033[0m", network.NetworkID)
+		removeSession()
+		fmt.Println("Done!")
+	},
+}
 
-		loadDefaultTemplate()
+func runStep(s string) error {
+	switch s {
+	case stepCoordinator:
+		return createCoordinatorNode()
+	case stepConsensus:
+		return createConsensusNode()
+	case stepSyncNodes:
+		count := 1
+		if autoFlag {
+			count = len(cfg.AnySyncNode.ListenAddr)
+		}
+		state, err := bld.State()
+		if err != nil {
+			return err
+		}
+		for i := len(state.SyncNodes); i < count; i++ {
+			if err := createSyncNode(i); err != nil {
+				return err
+			}
+			if err := saveSession(); err != nil {
+				return err
+			}
+		}
+		return nil
+	case stepFileNode:
+		count := 1
+		if autoFlag && cfg.AnySyncFilenode.Count > 1 {
+			count = cfg.AnySyncFilenode.Count
+		}
+		state, err := bld.State()
+		if err != nil {
+			return err
+		}
+		for i := len(state.FileNodes); i < count; i++ {
+			if err := createFileNode(); err != nil {
+				return err
+			}
+			if err := saveSession(); err != nil {
+				return err
+			}
+		}
+		return nil
+	case stepExtraNodes:
+		return lastStepOptions()
+	case stepConfigs:
+		return createConfigFiles()
+	}
+	return fmt.Errorf("unknown session step: %s", s)
+}
 
-		// Create coordinator node
-		fmt.Println("\nCreating coordinator node...")
+func createCoordinatorNode() error {
+	fmt.Println("\nCreating coordinator node...")
 
-		var defaultCoordinatorAddress = cfg.AnySyncCoordinator.ListenAddr
-		var defaultCoordinatorYamuxPort = strconv.Itoa(cfg.AnySyncCoordinator.YamuxPort)
-		var defaultCoordinatorQuicPort = strconv.Itoa(cfg.AnySyncCoordinator.QuicPort)
-		var defaultCoordinatorMongoConnect = cfg.AnySyncCoordinator.Mongo.Connect
-		var defaultCoordinatorMongoDb = cfg.AnySyncCoordinator.Mongo.Database
+	var defaultCoordinatorAddress = cfg.AnySyncCoordinator.ListenAddr
+	var defaultCoordinatorYamuxPort = strconv.Itoa(cfg.AnySyncCoordinator.YamuxPort)
+	var defaultCoordinatorQuicPort = strconv.Itoa(cfg.AnySyncCoordinator.QuicPort)
+	var defaultCoordinatorMongoConnect = cfg.AnySyncCoordinator.Mongo.Connect
+	var defaultCoordinatorMongoDb = cfg.AnySyncCoordinator.Mongo.Database
 
-		var coordinatorQs = []*survey.Question{
-			{
-				Name: "address",
-				Prompt: &survey.Input{
-					Message: "Any-Sync Coordinator Node address (without port)",
-					Default: defaultCoordinatorAddress,
-				},
-				Validate: survey.Required,
-			},
-			{
-				Name: "yamuxPort",
-				Prompt: &survey.Input{
-					Message: "Any-Sync Coordinator Node Yamux (TCP) port",
-					Default: defaultCoordinatorYamuxPort,
-				},
-				Validate: survey.Required,
+	var coordinatorQs = []*survey.Question{
+		{
+			Name: "address",
+			Prompt: &survey.Input{
+				Message: "Any-Sync Coordinator Node address (without port)",
+				Default: defaultCoordinatorAddress,
 			},
-			{
-				Name: "quicPort",
-				Prompt: &survey.Input{
-					Message: "Any-Sync Coordinator Node Quic (UDP) port",
-					Default: defaultCoordinatorQuicPort,
-				},
-				Validate: survey.Required,
+			Validate: survey.Required,
+		},
+		{
+			Name: "yamuxPort",
+			Prompt: &survey.Input{
+				Message: "Any-Sync Coordinator Node Yamux (TCP) port",
+				Default: defaultCoordinatorYamuxPort,
 			},
-			{
-				Name: "mongoConnect",
-				Prompt: &survey.Input{
-					Message: "Mongo connect URI",
-					Default: defaultCoordinatorMongoConnect,
-				},
-				Validate: survey.Required,
+			Validate: survey.Required,
+		},
+		{
+			Name: "quicPort",
+			Prompt: &survey.Input{
+				Message: "Any-Sync Coordinator Node Quic (UDP) port",
+				Default: defaultCoordinatorQuicPort,
 			},
-			{
-				Name: "mongoDB",
-				Prompt: &survey.Input{
-					Message: "Mongo database name",
-					Default: defaultCoordinatorMongoDb,
-				},
-				Validate: survey.Required,
+			Validate: survey.Required,
+		},
+		{
+			Name: "mongoDB",
+			Prompt: &survey.Input{
+				Message: "Mongo database name",
+				Default: defaultCoordinatorMongoDb,
 			},
-		}
+			Validate: survey.Required,
+		},
+	}
 
-		coordinatorAs := struct {
-			Address      string
-			YamuxPort    string
-			QuicPort     string
-			MongoConnect string
-			MongoDB      string
-		}{
-			Address:      defaultCoordinatorAddress,
-			YamuxPort:    defaultCoordinatorYamuxPort,
-			QuicPort:     defaultCoordinatorQuicPort,
-			MongoConnect: defaultCoordinatorMongoConnect,
-			MongoDB:      defaultCoordinatorMongoDb,
+	if !autoFlag {
+		if err := askMongoSettings(); err != nil {
+			return err
 		}
+	}
+	if len(cfg.Mongo.Hosts) == 0 {
+		coordinatorQs = append(coordinatorQs, &survey.Question{
+			Name: "mongoConnect",
+			Prompt: &survey.Input{
+				Message: "Mongo connect URI",
+				Default: defaultCoordinatorMongoConnect,
+			},
+			Validate: survey.Required,
+		})
+	}
 
-		if !autoFlag {
-			err := survey.Ask(coordinatorQs, &coordinatorAs)
-			if err != nil {
-				fmt.Println(err.Error())
-				return
-			}
+	coordinatorAs := struct {
+		Address      string
+		YamuxPort    string
+		QuicPort     string
+		MongoConnect string
+		MongoDB      string
+	}{
+		Address:      defaultCoordinatorAddress,
+		YamuxPort:    defaultCoordinatorYamuxPort,
+		QuicPort:     defaultCoordinatorQuicPort,
+		MongoConnect: defaultCoordinatorMongoConnect,
+		MongoDB:      defaultCoordinatorMongoDb,
+	}
+
+	if !autoFlag {
+		err := survey.Ask(coordinatorQs, &coordinatorAs)
+		if err != nil {
+			return err
 		}
+	}
 
-		coordinatorNode := defaultCoordinatorNode()
-		coordinatorNode.Yamux.ListenAddrs = append(coordinatorNode.Yamux.ListenAddrs, coordinatorAs.Address+":"+coordinatorAs.YamuxPort)
-		coordinatorNode.Quic.ListenAddrs = append(coordinatorNode.Quic.ListenAddrs, coordinatorAs.Address+":"+coordinatorAs.QuicPort)
-		coordinatorNode.Mongo.Connect = coordinatorAs.MongoConnect
-		coordinatorNode.Mongo.Database = coordinatorAs.MongoDB
-		coordinatorNode.Account = generateAccount()
-		coordinatorNode.Account.SigningKey, _ = crypto.EncodeKeyToString(netKey)
+	listen, err := listenOption(coordinatorAs.Address, coordinatorAs.YamuxPort, coordinatorAs.QuicPort)
+	if err != nil {
+		return err
+	}
 
-		addToNetwork(coordinatorNode.GeneralNodeConfig, "coordinator")
+	mongoConnect, err := mongoConnectURI(coordinatorAs.MongoConnect)
+	if err != nil {
+		return err
+	}
 
-		// Create consensus node
-		fmt.Println("\nCreating consensus node...")
+	_, err = bld.AddCoordinator(
+		listen,
+		builder.WithExternalPorts(cfg.AnySyncCoordinator.YamuxPort, cfg.AnySyncCoordinator.QuicPort),
+		builder.WithMongo(mongoConnect, coordinatorAs.MongoDB),
+		builder.WithSpaceLimits(builder.SpaceLimits{
+			SpaceMembersRead:  cfg.AnySyncCoordinator.DefaultLimits.SpaceMembersRead,
+			SpaceMembersWrite: cfg.AnySyncCoordinator.DefaultLimits.SpaceMembersWrite,
+			SharedSpacesLimit: cfg.AnySyncCoordinator.DefaultLimits.SharedSpacesLimit,
+		}),
+	)
+	return err
+}
 
-		var defaultConsensusAddress = cfg.AnySyncConsensusNode.ListenAddr
-		var defaultConsensusYamuxPort = strconv.Itoa(cfg.AnySyncConsensusNode.YamuxPort)
-		var defaultConsensusQuicPort = strconv.Itoa(cfg.AnySyncConsensusNode.QuicPort)
-		var defaultConsensusMongoDB = cfg.AnySyncConsensusNode.Mongo.Database
+func createConsensusNode() error {
+	fmt.Println("\nCreating consensus node...")
 
-		var consensusQs = []*survey.Question{
-			{
-				Name: "address",
-				Prompt: &survey.Input{
-					Message: "Any-Sync Consensus Node address (without port)",
-					Default: defaultConsensusAddress,
-				},
-				Validate: survey.Required,
+	var defaultConsensusAddress = cfg.AnySyncConsensusNode.ListenAddr
+	var defaultConsensusYamuxPort = strconv.Itoa(cfg.AnySyncConsensusNode.YamuxPort)
+	var defaultConsensusQuicPort = strconv.Itoa(cfg.AnySyncConsensusNode.QuicPort)
+	var defaultConsensusMongoDB = cfg.AnySyncConsensusNode.Mongo.Database
+	var defaultConsensusMongoConnect = cfg.AnySyncConsensusNode.Mongo.Connect
+
+	var consensusQs = []*survey.Question{
+		{
+			Name: "address",
+			Prompt: &survey.Input{
+				Message: "Any-Sync Consensus Node address (without port)",
+				Default: defaultConsensusAddress,
 			},
-			{
-				Name: "yamuxPort",
-				Prompt: &survey.Input{
-					Message: "Any-Sync Consensus Node Yamux (TCP) port",
-					Default: defaultConsensusYamuxPort,
-				},
-				Validate: survey.Required,
+			Validate: survey.Required,
+		},
+		{
+			Name: "yamuxPort",
+			Prompt: &survey.Input{
+				Message: "Any-Sync Consensus Node Yamux (TCP) port",
+				Default: defaultConsensusYamuxPort,
 			},
-			{
-				Name: "quicPort",
-				Prompt: &survey.Input{
-					Message: "Any-Sync Consensus Node Quic (UDP) port",
-					Default: defaultConsensusQuicPort,
-				},
-				Validate: survey.Required,
+			Validate: survey.Required,
+		},
+		{
+			Name: "quicPort",
+			Prompt: &survey.Input{
+				Message: "Any-Sync Consensus Node Quic (UDP) port",
+				Default: defaultConsensusQuicPort,
 			},
-			{
-				Name: "mongoDB",
-				Prompt: &survey.Input{
-					Message: "Any-Sync Consensus Mongo database name",
-					Default: defaultConsensusMongoDB,
-				},
-				Validate: survey.Required,
+			Validate: survey.Required,
+		},
+		{
+			Name: "mongoDB",
+			Prompt: &survey.Input{
+				Message: "Any-Sync Consensus Mongo database name",
+				Default: defaultConsensusMongoDB,
 			},
-		}
+			Validate: survey.Required,
+		},
+	}
 
-		consensusAs := struct {
-			Address   string
-			YamuxPort string
-			QuicPort  string
-			MongoDB   string
-		}{
-			Address:   defaultConsensusAddress,
-			YamuxPort: defaultConsensusYamuxPort,
-			QuicPort:  defaultConsensusQuicPort,
-			MongoDB:   defaultConsensusMongoDB,
-		}
+	if len(cfg.Mongo.Hosts) == 0 {
+		consensusQs = append(consensusQs, &survey.Question{
+			Name: "mongoConnect",
+			Prompt: &survey.Input{
+				Message: "Any-Sync Consensus Mongo connect URI",
+				Default: defaultConsensusMongoConnect,
+			},
+			Validate: survey.Required,
+		})
+	}
 
-		if !autoFlag {
-			err := survey.Ask(consensusQs, &consensusAs)
-			if err != nil {
-				fmt.Println(err.Error())
-				return
-			}
+	consensusAs := struct {
+		Address      string
+		YamuxPort    string
+		QuicPort     string
+		MongoDB      string
+		MongoConnect string
+	}{
+		Address:      defaultConsensusAddress,
+		YamuxPort:    defaultConsensusYamuxPort,
+		QuicPort:     defaultConsensusQuicPort,
+		MongoDB:      defaultConsensusMongoDB,
+		MongoConnect: defaultConsensusMongoConnect,
+	}
+
+	if !autoFlag {
+		err := survey.Ask(consensusQs, &consensusAs)
+		if err != nil {
+			return err
 		}
+	}
 
-		consensusNode := defaultConsensusNode()
-		consensusNode.Yamux.ListenAddrs = append(consensusNode.Yamux.ListenAddrs, consensusAs.Address+":"+consensusAs.YamuxPort)
-		consensusNode.Quic.ListenAddrs = append(consensusNode.Quic.ListenAddrs, consensusAs.Address+":"+consensusAs.QuicPort)
-		consensusNode.Mongo.Connect = cfg.AnySyncConsensusNode.Mongo.Connect
-		consensusNode.Mongo.Database = consensusAs.MongoDB
-		consensusNode.Account = generateAccount()
+	listen, err := listenOption(consensusAs.Address, consensusAs.YamuxPort, consensusAs.QuicPort)
+	if err != nil {
+		return err
+	}
 
-		addToNetwork(consensusNode.GeneralNodeConfig, "consensus")
+	mongoConnect, err := mongoConnectURI(consensusAs.MongoConnect)
+	if err != nil {
+		return err
+	}
 
-		listenCount := len(cfg.AnySyncNode.ListenAddr)
-		if !autoFlag {
-			createSyncNode(0)
-		} else {
-			for i := 0; i < listenCount; i++ {
-				createSyncNode(i)
-			}
-		}
+	_, err = bld.AddConsensus(
+		listen,
+		builder.WithExternalPorts(cfg.AnySyncConsensusNode.YamuxPort, cfg.AnySyncConsensusNode.QuicPort),
+		builder.WithMongo(mongoConnect, consensusAs.MongoDB),
+	)
+	return err
+}
 
-		createFileNode()
+func createConfigFiles() error {
+	if err := checkReplication(); err != nil {
+		return err
+	}
 
-		lastStepOptions()
+	res, err := bld.Build()
+	if err != nil {
+		return err
+	}
 
-		// Create configurations for all nodes
-		fmt.Println("\nCreating config file...")
+	var nodeTmpl *template.Template
+	if nodeTemplatePath != "" {
+		if nodeTmpl, err = builder.LoadTemplate(nodeTemplatePath); err != nil {
+			return err
+		}
+	}
 
-		coordinatorNode.Network = network
-		createConfigFile(coordinatorNode, "etc/any-sync-coordinator/config")
+	// Create configurations for all nodes
+	fmt.Println("\nCreating config file...")
 
-		consensusNode.Network = network
-		createConfigFile(consensusNode, "etc/any-sync-consensusnode/config")
+	for _, coordinatorNode := range res.Coordinators {
+		if err = createNodeConfigFile(nodeTmpl, coordinatorNode, coordinatorNode.GeneralNodeConfig, "etc/any-sync-coordinator/config"); err != nil {
+			return err
+		}
+	}
 
-		for i, syncNode := range syncNodes {
-			syncNode.Network = network
-			createConfigFile(syncNode, "etc/any-sync-node-"+strconv.Itoa(i+1)+"/config")
+	for _, consensusNode := range res.ConsensusNodes {
+		if err = createNodeConfigFile(nodeTmpl, consensusNode, consensusNode.GeneralNodeConfig, "etc/any-sync-consensusnode/config"); err != nil {
+			return err
 		}
+	}
 
-		for i, fileNode := range fileNodes {
-			fileNode.Network = network
-			if i == 0 {
-				createConfigFile(fileNode, "etc/any-sync-filenode/config")
-			} else {
-				createConfigFile(fileNode, "etc/any-sync-filenode-"+strconv.Itoa(i+1)+"/config")
-			}
+	for i, syncNode := range res.SyncNodes {
+		if err = createNodeConfigFile(nodeTmpl, syncNode, syncNode.GeneralNodeConfig, "etc/any-sync-node-"+strconv.Itoa(i+1)+"/config"); err != nil {
+			return err
 		}
+	}
 
-		createConfigFile(network.HeartConfig, "etc/client")                       // to import to client app
-		createConfigFile(network.HeartConfig, "etc/any-sync-coordinator/network") // to any-sync-confapply tool
+	for i, fileNode := range res.FileNodes {
+		path := "etc/any-sync-filenode/config"
+		if i > 0 {
+			path = "etc/any-sync-filenode-" + strconv.Itoa(i+1) + "/config"
+		}
+		if err = createNodeConfigFile(nodeTmpl, fileNode, fileNode.GeneralNodeConfig, path); err != nil {
+			return err
+		}
+	}
 
-		fmt.Println("Done!")
-	},
-}
+	for i, namingNode := range res.NamingNodes {
+		path := "etc/any-sync-namingnode/config"
+		if i > 0 {
+			path = "etc/any-sync-namingnode-" + strconv.Itoa(i+1) + "/config"
+		}
+		if err = createNodeConfigFile(nodeTmpl, namingNode, namingNode, path); err != nil {
+			return err
+		}
+	}
 
-var network = Network{}
-
-func addToNetwork(node GeneralNodeConfig, nodeType string, index ...int) {
-	addresses := []string{}
-	yamuxPort := 0
-	quicPort := 0
-
-	switch nodeType {
-	case "coordinator":
-		yamuxPort = cfg.AnySyncCoordinator.YamuxPort
-		quicPort = cfg.AnySyncCoordinator.QuicPort
-	case "consensus":
-		yamuxPort = cfg.AnySyncConsensusNode.YamuxPort
-		quicPort = cfg.AnySyncConsensusNode.QuicPort
-	case "file":
-		yamuxPort = cfg.AnySyncFilenode.YamuxPort
-		quicPort = cfg.AnySyncFilenode.QuicPort
-	case "tree":
-		if len(index) > 0 {
-			yamuxPort = cfg.AnySyncNode.YamuxPort[index[0]]
-			quicPort = cfg.AnySyncNode.QuicPort[index[0]]
-		} else {
-			fmt.Println("Error: Index required for tree node type")
-			return
+	for i, paymentNode := range res.PaymentNodes {
+		path := "etc/any-sync-paymentprocessingnode/config"
+		if i > 0 {
+			path = "etc/any-sync-paymentprocessingnode-" + strconv.Itoa(i+1) + "/config"
+		}
+		if err = createNodeConfigFile(nodeTmpl, paymentNode, paymentNode, path); err != nil {
+			return err
 		}
 	}
 
-	for _, addr := range node.Yamux.ListenAddrs {
-		addresses = append(addresses, addr)
+	if len(cfg.Mongo.Hosts) > 0 {
+		var databases []string
+		for _, coordinatorNode := range res.Coordinators {
+			databases = append(databases, coordinatorNode.Mongo.Database)
+		}
+		for _, consensusNode := range res.ConsensusNodes {
+			databases = append(databases, consensusNode.Mongo.Database)
+		}
+		script, err := cfg.Mongo.InitScript(databases...)
+		if err != nil {
+			return err
+		}
+		// the script has only the mongo user name, mongosh prompts for the password
+		if err = os.WriteFile("etc/mongo-init.js", []byte(script), 0600); err != nil {
+			return fmt.Errorf("could not write the mongo init script: %w", err)
+		}
 	}
-	for _, addr := range node.Quic.ListenAddrs {
-		addresses = append(addresses, "quic://"+addr)
+
+	createConfigFile(res.Network.HeartConfig, "etc/client", 0644)                       // to import to client app
+	createConfigFile(res.Network.HeartConfig, "etc/any-sync-coordinator/network", 0644) // to any-sync-confapply tool
+	return nil
+}
+
+// listenOption parses the answered ports of a node
+func listenOption(address, yamuxPort, quicPort string) (builder.NodeOption, error) {
+	yPort, err := strconv.Atoi(yamuxPort)
+	if err != nil {
+		return nil, fmt.Errorf("wrong yamux port '%s'", yamuxPort)
 	}
-	for _, extAddr := range cfg.ExternalAddr {
-		addresses = append(addresses, extAddr+":"+strconv.Itoa(yamuxPort))
-		addresses = append(addresses, "quic://"+extAddr+":"+strconv.Itoa(quicPort))
+	qPort, err := strconv.Atoi(quicPort)
+	if err != nil {
+		return nil, fmt.Errorf("wrong quic port '%s'", quicPort)
 	}
-	network.Nodes = append(network.Nodes, Node{
-		PeerID:    node.Account.PeerId,
-		Addresses: addresses,
-		Types:     []string{nodeType},
-	})
+	return builder.WithListen(address, yPort, qPort), nil
 }
 
-var syncNodes = []SyncNodeConfig{}
-
-func createSyncNode(index int) {
+func createSyncNode(index int) error {
 	var defaultSyncNodeAddress = cfg.AnySyncNode.ListenAddr[index]
 	var defaultSyncNodeYamuxPort = strconv.Itoa(cfg.AnySyncNode.YamuxPort[index])
 	var defaultSyncNodeQuicPort = strconv.Itoa(cfg.AnySyncNode.QuicPort[index])
@@ -504,32 +576,57 @@ func createSyncNode(index int) {
 	if !autoFlag {
 		err := survey.Ask(syncQs, &answers)
 		if err != nil {
-			fmt.Println(err.Error())
-			return
+			return err
 		}
 	}
 
-	syncNode := defaultSyncNode()
-	syncNode.Yamux.ListenAddrs = append(syncNode.Yamux.ListenAddrs, answers.Address+":"+answers.YamuxPort)
-	syncNode.Quic.ListenAddrs = append(syncNode.Quic.ListenAddrs, answers.Address+":"+answers.QuicPort)
-	syncNode.Account = generateAccount()
+	listen, err := listenOption(answers.Address, answers.YamuxPort, answers.QuicPort)
+	if err != nil {
+		return err
+	}
 
-	addToNetwork(syncNode.GeneralNodeConfig, "tree", index)
-	syncNodes = append(syncNodes, syncNode)
+	_, err = bld.AddSyncNode(
+		listen,
+		builder.WithExternalPorts(cfg.AnySyncNode.YamuxPort[index], cfg.AnySyncNode.QuicPort[index]),
+	)
+	return err
 }
 
-var fileNodes = []FileNodeConfig{}
+const (
+	credentialsProfile = "AWS profile"
+	credentialsKeys    = "Access keys"
 
-func createFileNode() {
+	redisStandalone = "standalone"
+	redisCluster    = "cluster"
+	redisSentinel   = "sentinel"
+)
+
+func createFileNode() error {
 	var defaultFileNodeAddress = cfg.AnySyncFilenode.ListenAddr
 	var defaultFileNodeYamuxPort = strconv.Itoa(cfg.AnySyncFilenode.YamuxPort)
 	var defaultFileNodeQuicPort = strconv.Itoa(cfg.AnySyncFilenode.QuicPort)
-	var defaultS3Endpoint = cfg.AnySyncFilenode.S3Store.Endpoint
-	var defaultS3Region = cfg.AnySyncFilenode.S3Store.Region
-	var defaultS3Profile = cfg.AnySyncFilenode.S3Store.Profile
-	var defaultS3Bucket = cfg.AnySyncFilenode.S3Store.Bucket
-	var defaultRedisUrl = cfg.AnySyncFilenode.Redis.URL
-	var defaultRedisCluster = "false"
+	var defaultS3 = cfg.AnySyncFilenode.S3Store
+	var defaultRedis = cfg.AnySyncFilenode.Redis
+
+	var defaultIndexBucket = defaultS3.IndexBucket
+	if defaultIndexBucket == "" {
+		defaultIndexBucket = defaultS3.Bucket
+	}
+	var defaultMaxThreads = "16"
+	if defaultS3.MaxThreads > 0 {
+		defaultMaxThreads = strconv.Itoa(defaultS3.MaxThreads)
+	}
+	var defaultCredentials = credentialsProfile
+	if defaultS3.Credentials.AccessKey != "" {
+		defaultCredentials = credentialsKeys
+	}
+	var defaultRedisMode = redisStandalone
+	switch {
+	case defaultRedis.Sentinel.MasterName != "":
+		defaultRedisMode = redisSentinel
+	case defaultRedis.IsCluster:
+		defaultRedisMode = redisCluster
+	}
 
 	fmt.Println("\nCreating file node...")
 
@@ -563,311 +660,467 @@ func createFileNode() {
 			Prompt: &survey.Input{
 				Message: "S3 Endpoint",
 				Help:    "Required only in the case you self-host S3-compatible object storage",
-				Default: defaultS3Endpoint,
+				Default: defaultS3.Endpoint,
 			},
 		},
 		{
 			Name: "s3Region",
 			Prompt: &survey.Input{
 				Message: "S3 Region",
-				Default: defaultS3Region,
+				Default: defaultS3.Region,
 			},
 			Validate: survey.Required,
 		},
 		{
-			Name: "s3Profile",
+			Name: "s3Bucket",
 			Prompt: &survey.Input{
-				Message: "S3 Profile",
-				Default: defaultS3Profile,
+				Message: "S3 Bucket",
+				Default: defaultS3.Bucket,
 			},
 			Validate: survey.Required,
 		},
 		{
-			Name: "s3Bucket",
+			Name: "s3IndexBucket",
 			Prompt: &survey.Input{
-				Message: "S3 Bucket",
-				Default: defaultS3Bucket,
+				Message: "S3 Index Bucket",
+				Default: defaultIndexBucket,
 			},
 			Validate: survey.Required,
 		},
 		{
-			Name: "redisURL",
+			Name: "s3ForcePathStyle",
+			Prompt: &survey.Confirm{
+				Message: "Use path-style S3 URLs?",
+				Help:    "Usually required for self-hosted S3-compatible object storage like Minio",
+				Default: defaultS3.ForcePathStyle,
+			},
+		},
+		{
+			Name: "s3MaxThreads",
 			Prompt: &survey.Input{
-				Message: "Redis URL",
-				Default: defaultRedisUrl,
+				Message: "S3 max threads",
+				Default: defaultMaxThreads,
 			},
 			Validate: survey.Required,
 		},
 		{
-			Name: "redisCluster",
+			Name: "s3Credentials",
 			Prompt: &survey.Select{
-				Message: "Is your redis installation a cluster?",
-				Options: []string{"true", "false"},
-				Default: defaultRedisCluster,
+				Message: "How should the file node authenticate to S3?",
+				Options: []string{credentialsProfile, credentialsKeys},
+				Default: defaultCredentials,
+			},
+		},
+		{
+			Name: "defaultLimit",
+			Prompt: &survey.Input{
+				Message: "Default space storage limit (bytes)",
+				Default: strconv.Itoa(cfg.AnySyncFilenode.DefaultLimit),
 			},
 			Validate: survey.Required,
 		},
+		{
+			Name: "redisMode",
+			Prompt: &survey.Select{
+				Message: "What is your redis installation?",
+				Options: []string{redisStandalone, redisCluster, redisSentinel},
+				Default: defaultRedisMode,
+			},
+		},
 	}
 
 	answers := struct {
-		Address      string
-		YamuxPort    string
-		QuicPort     string
-		S3Endpoint   string
-		S3Region     string
-		S3Profile    string
-		S3Bucket     string
-		RedisURL     string
-		RedisCluster string
+		Address          string
+		YamuxPort        string
+		QuicPort         string
+		S3Endpoint       string
+		S3Region         string
+		S3Bucket         string
+		S3IndexBucket    string
+		S3ForcePathStyle bool
+		S3MaxThreads     string
+		S3Credentials    string
+		DefaultLimit     string
+		RedisMode        string
 	}{
-		Address:      defaultFileNodeAddress,
-		YamuxPort:    defaultFileNodeYamuxPort,
-		QuicPort:     defaultFileNodeQuicPort,
-		S3Endpoint:   defaultS3Endpoint,
-		S3Region:     defaultS3Region,
-		S3Profile:    defaultS3Profile,
-		S3Bucket:     defaultS3Bucket,
-		RedisURL:     defaultRedisUrl,
-		RedisCluster: defaultRedisCluster,
+		Address:          defaultFileNodeAddress,
+		YamuxPort:        defaultFileNodeYamuxPort,
+		QuicPort:         defaultFileNodeQuicPort,
+		S3Endpoint:       defaultS3.Endpoint,
+		S3Region:         defaultS3.Region,
+		S3Bucket:         defaultS3.Bucket,
+		S3IndexBucket:    defaultIndexBucket,
+		S3ForcePathStyle: defaultS3.ForcePathStyle,
+		S3MaxThreads:     defaultMaxThreads,
+		S3Credentials:    defaultCredentials,
+		DefaultLimit:     strconv.Itoa(cfg.AnySyncFilenode.DefaultLimit),
+		RedisMode:        defaultRedisMode,
 	}
 
 	if !autoFlag {
 		err := survey.Ask(fileQs, &answers)
 		if err != nil {
-			fmt.Println(err.Error())
-			return
+			return err
 		}
 	}
 
-	fileNode := defaultFileNode()
-	fileNode.Yamux.ListenAddrs = append(fileNode.Yamux.ListenAddrs, answers.Address+":"+answers.YamuxPort)
-	fileNode.Quic.ListenAddrs = append(fileNode.Quic.ListenAddrs, answers.Address+":"+answers.QuicPort)
-	fileNode.S3Store.Endpoint = answers.S3Endpoint
-	fileNode.S3Store.Region = answers.S3Region
-	fileNode.S3Store.Profile = answers.S3Profile
-	fileNode.S3Store.Bucket = answers.S3Bucket
-	fileNode.Redis.URL = answers.RedisURL
-	fileNode.Redis.IsCluster, _ = strconv.ParseBool(answers.RedisCluster)
-	fileNode.Account = generateAccount()
+	var credentialsQs []*survey.Question
+	if answers.S3Credentials == credentialsProfile {
+		credentialsQs = []*survey.Question{
+			{
+				Name: "profile",
+				Prompt: &survey.Input{
+					Message: "S3 Profile",
+					Default: defaultS3.Profile,
+				},
+				Validate: survey.Required,
+			},
+		}
+	} else {
+		credentialsQs = []*survey.Question{
+			{
+				Name: "accessKey",
+				Prompt: &survey.Input{
+					Message: "S3 Access Key",
+					Help:    staticSecretHelp,
+					Default: defaultS3.Credentials.AccessKey,
+				},
+				Validate: survey.Required,
+			},
+			{
+				Name: "secretKey",
+				Prompt: &survey.Password{
+					Message: "S3 Secret Key",
+					Help:    secretHelp(defaultS3.Credentials.SecretKey),
+				},
+				Validate: requiredSecret(defaultS3.Credentials.SecretKey),
+			},
+		}
+	}
 
-	addToNetwork(fileNode.GeneralNodeConfig, "file")
-	fileNodes = append(fileNodes, fileNode)
+	credentialsAs := struct {
+		Profile   string
+		AccessKey string
+		SecretKey string
+	}{
+		Profile:   defaultS3.Profile,
+		AccessKey: defaultS3.Credentials.AccessKey,
+		SecretKey: defaultS3.Credentials.SecretKey,
+	}
 
-	// Increase file node port
-	cfg.AnySyncFilenode.YamuxPort++
-	cfg.AnySyncFilenode.QuicPort++
-}
+	var redisQs []*survey.Question
+	if answers.RedisMode == redisSentinel {
+		redisQs = []*survey.Question{
+			{
+				Name: "masterName",
+				Prompt: &survey.Input{
+					Message: "Redis Sentinel master name",
+					Default: defaultRedis.Sentinel.MasterName,
+				},
+				Validate: survey.Required,
+			},
+			{
+				Name: "sentinelAddrs",
+				Prompt: &survey.Input{
+					Message: "Redis Sentinel addresses (comma separated host:port)",
+					Default: strings.Join(defaultRedis.Sentinel.Addrs, ","),
+				},
+				Validate: survey.Required,
+			},
+			{
+				Name: "password",
+				Prompt: &survey.Password{
+					Message: "Redis Sentinel password",
+					Help:    secretHelp(defaultRedis.Sentinel.Password),
+				},
+			},
+		}
+	} else {
+		redisQs = []*survey.Question{
+			{
+				Name: "url",
+				Prompt: &survey.Input{
+					Message: "Redis URL",
+					Default: defaultRedis.URL,
+				},
+				Validate: survey.Required,
+			},
+		}
+	}
 
-func lastStepOptions() {
-	fmt.Println()
-	prompt := &survey.Select{
-		Message: "Do you want to add more nodes?",
-		Options: []string{"No, generate configs", "Add sync-node", "Add file-node"},
-		Default: "No, generate configs",
+	redisAs := struct {
+		URL           string
+		MasterName    string
+		SentinelAddrs string
+		Password      string
+	}{
+		URL:           defaultRedis.URL,
+		MasterName:    defaultRedis.Sentinel.MasterName,
+		SentinelAddrs: strings.Join(defaultRedis.Sentinel.Addrs, ","),
+		Password:      defaultRedis.Sentinel.Password,
 	}
 
 	if !autoFlag {
-		option := ""
-		survey.AskOne(prompt, &option, survey.WithValidator(survey.Required))
-		switch option {
-		case "Add sync-node":
-			createSyncNode(0)
-			lastStepOptions()
-		case "Add file-node":
-			createFileNode()
-			lastStepOptions()
-		default:
-			return
+		if err := survey.Ask(credentialsQs, &credentialsAs); err != nil {
+			return err
 		}
+		if err := survey.Ask(redisQs, &redisAs); err != nil {
+			return err
+		}
+		keepSecret(&credentialsAs.SecretKey, defaultS3.Credentials.SecretKey)
+		keepSecret(&redisAs.Password, defaultRedis.Sentinel.Password)
 	}
-}
 
-func generateAccount() accountservice.Config {
-	signKey, _, _ := crypto.GenerateRandomEd25519KeyPair()
-
-	encPeerSignKey, err := crypto.EncodeKeyToString(signKey)
+	listen, err := listenOption(answers.Address, answers.YamuxPort, answers.QuicPort)
+	if err != nil {
+		return err
+	}
+	maxThreads, err := strconv.Atoi(answers.S3MaxThreads)
 	if err != nil {
-		return accountservice.Config{}
+		return fmt.Errorf("wrong S3 max threads '%s'", answers.S3MaxThreads)
+	}
+	defaultLimit, err := strconv.Atoi(answers.DefaultLimit)
+	if err != nil {
+		return fmt.Errorf("wrong default limit '%s'", answers.DefaultLimit)
+	}
+
+	s3Store := builder.S3StoreConfig{
+		Endpoint:       answers.S3Endpoint,
+		Bucket:         answers.S3Bucket,
+		IndexBucket:    answers.S3IndexBucket,
+		Region:         answers.S3Region,
+		MaxThreads:     maxThreads,
+		ForcePathStyle: answers.S3ForcePathStyle,
+	}
+	if answers.S3Credentials == credentialsProfile {
+		s3Store.Profile = credentialsAs.Profile
+	} else {
+		if s3Store.Credentials.AccessKey, err = resolveSecret(credentialsAs.AccessKey); err != nil {
+			return err
+		}
+		if s3Store.Credentials.SecretKey, err = resolveSecret(credentialsAs.SecretKey); err != nil {
+			return err
+		}
 	}
 
-	peerID := signKey.GetPublic().PeerId()
+	redis := builder.RedisConfig{
+		IsCluster: answers.RedisMode == redisCluster,
+		URL:       redisAs.URL,
+	}
+	if answers.RedisMode == redisSentinel {
+		redis.URL = ""
+		redis.Sentinel = &builder.RedisSentinelConfig{
+			MasterName: redisAs.MasterName,
+		}
+		for _, addr := range strings.Split(redisAs.SentinelAddrs, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				redis.Sentinel.Addrs = append(redis.Sentinel.Addrs, addr)
+			}
+		}
+		if redis.Sentinel.Password, err = resolveSecret(redisAs.Password); err != nil {
+			return err
+		}
+	}
 
-	return accountservice.Config{
-		PeerId:     peerID,
-		PeerKey:    encPeerSignKey,
-		SigningKey: encPeerSignKey,
+	_, err = bld.AddFileNode(
+		listen,
+		builder.WithExternalPorts(cfg.AnySyncFilenode.YamuxPort, cfg.AnySyncFilenode.QuicPort),
+		builder.WithS3Store(s3Store),
+		builder.WithRedis(redis),
+		builder.WithDefaultLimit(defaultLimit),
+	)
+	if err != nil {
+		return err
 	}
+
+	// Increase file node port
+	cfg.AnySyncFilenode.YamuxPort++
+	cfg.AnySyncFilenode.QuicPort++
+	return nil
 }
 
-func defaultGeneralNode() GeneralNodeConfig {
-	return GeneralNodeConfig{
-		Drpc: struct {
-			Snappy bool `yaml:"snappy"`
-			Stream struct {
-				MaxMsgSizeMb int "yaml:\"maxMsgSizeMb\""
-			} "yaml:\"stream\""
-		}{
-			Snappy: true,
-			Stream: struct {
-				MaxMsgSizeMb int "yaml:\"maxMsgSizeMb\""
-			}{
-				MaxMsgSizeMb: 256,
+// createServiceNode adds a naming or payment processing node.
+// They get only the common config sections, the service specific ones can be added with --node-template
+func createServiceNode(nodeType nodeconf.NodeType) error {
+	tmpl := &cfg.AnySyncNamingNode
+	add := bld.AddNamingNode
+	name := "Naming Node"
+	if nodeType == nodeconf.NodeTypePaymentProcessingNode {
+		tmpl = &cfg.AnySyncPaymentProcessingNode
+		add = bld.AddPaymentProcessingNode
+		name = "Payment Processing Node"
+	}
+
+	var defaultAddress = tmpl.ListenAddr
+	var defaultYamuxPort = strconv.Itoa(tmpl.YamuxPort)
+	var defaultQuicPort = strconv.Itoa(tmpl.QuicPort)
+
+	fmt.Printf("\nCreating %s...\n", strings.ToLower(name))
+
+	var serviceQs = []*survey.Question{
+		{
+			Name: "address",
+			Prompt: &survey.Input{
+				Message: "Any-Sync " + name + " address (without port)",
+				Default: defaultAddress,
 			},
+			Validate: survey.Required,
 		},
-		Yamux: struct {
-			ListenAddrs     []string "yaml:\"listenAddrs\""
-			WriteTimeoutSec int      "yaml:\"writeTimeoutSec\""
-			DialTimeoutSec  int      "yaml:\"dialTimeoutSec\""
-		}{
-			WriteTimeoutSec: 10,
-			DialTimeoutSec:  10,
-		},
-		Quic: struct {
-			ListenAddrs     []string "yaml:\"listenAddrs\""
-			WriteTimeoutSec int      "yaml:\"writeTimeoutSec\""
-			DialTimeoutSec  int      "yaml:\"dialTimeoutSec\""
-		}{
-			WriteTimeoutSec: 10,
-			DialTimeoutSec:  10,
-		},
-		NetworkStorePath: "/networkStore",
-		Log: struct {
-			Production   bool     "yaml:\"production\""
-			DefaultLevel string   "yaml:\"defaultLevel\""
-			NamedLevels  struct{} "yaml:\"namedLevels\""
-		}{
-			Production:   false,
-			DefaultLevel: "",
-			NamedLevels:  struct{}{},
+		{
+			Name: "yamuxPort",
+			Prompt: &survey.Input{
+				Message: "Any-Sync " + name + " Yamux (TCP) port",
+				Default: defaultYamuxPort,
+			},
+			Validate: survey.Required,
 		},
-		Metric: struct {
-			Addr string "yaml:\"addr\""
-		}{
-			Addr: "0.0.0.0:8000",
+		{
+			Name: "quicPort",
+			Prompt: &survey.Input{
+				Message: "Any-Sync " + name + " Quic (UDP) port",
+				Default: defaultQuicPort,
+			},
+			Validate: survey.Required,
 		},
 	}
-}
 
-func defaultCoordinatorNode() CoordinatorNodeConfig {
-	return CoordinatorNodeConfig{
-		GeneralNodeConfig: defaultGeneralNode(),
-		Mongo: struct {
-			Connect  string "yaml:\"connect\""
-			Database string "yaml:\"database\""
-			Log      string "yaml:\"log\""
-			Spaces   string "yaml:\"spaces\""
-		}{
-			Log:    "log",
-			Spaces: "spaces",
-		},
-		SpaceStatus: struct {
-			RunSeconds         int "yaml:\"runSeconds\""
-			DeletionPeriodDays int "yaml:\"deletionPeriodDays\""
-		}{
-			RunSeconds:         5,
-			DeletionPeriodDays: 0,
-		},
-		DefaultLimits: struct {
-			SpaceMembersRead  int "yaml:\"spaceMembersRead\""
-			SpaceMembersWrite int "yaml:\"spaceMembersWrite\""
-			SharedSpacesLimit int "yaml:\"sharedSpacesLimit\""
-		}{
-			SpaceMembersRead:  cfg.AnySyncCoordinator.DefaultLimits.SpaceMembersRead,
-			SpaceMembersWrite: cfg.AnySyncCoordinator.DefaultLimits.SpaceMembersWrite,
-			SharedSpacesLimit: cfg.AnySyncCoordinator.DefaultLimits.SharedSpacesLimit,
-		},
+	answers := struct {
+		Address   string
+		YamuxPort string
+		QuicPort  string
+	}{
+		Address:   defaultAddress,
+		YamuxPort: defaultYamuxPort,
+		QuicPort:  defaultQuicPort,
 	}
-}
 
-func defaultConsensusNode() ConsensusNodeConfig {
-	return ConsensusNodeConfig{
-		GeneralNodeConfig: defaultGeneralNode(),
-		Mongo: struct {
-			Connect       string "yaml:\"connect\""
-			Database      string "yaml:\"database\""
-			LogCollection string "yaml:\"logCollection\""
-		}{
-			LogCollection: "log",
-		},
+	if !autoFlag {
+		err := survey.Ask(serviceQs, &answers)
+		if err != nil {
+			return err
+		}
+	}
+
+	listen, err := listenOption(answers.Address, answers.YamuxPort, answers.QuicPort)
+	if err != nil {
+		return err
 	}
+
+	_, err = add(
+		listen,
+		builder.WithExternalPorts(tmpl.YamuxPort, tmpl.QuicPort),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Increase node ports
+	tmpl.YamuxPort++
+	tmpl.QuicPort++
+	return nil
 }
 
-func defaultSyncNode() SyncNodeConfig {
-	return SyncNodeConfig{
-		GeneralNodeConfig: defaultGeneralNode(),
-		Space: struct {
-			GcTTL      int "yaml:\"gcTTL\""
-			SyncPeriod int "yaml:\"syncPeriod\""
-		}{
-			GcTTL:      60,
-			SyncPeriod: 600,
-		},
-		Storage: struct {
-			Path string "yaml:\"path\""
-			AnyStorePath string "yaml:\"anyStorePath\""
-		}{
-			Path: "/storage",
-			AnyStorePath: "/anyStorage",
-		},
-		NodeSync: struct {
-			SyncOnStart       bool "yaml:\"syncOnStart\""
-			PeriodicSyncHours int  "yaml:\"periodicSyncHours\""
-		}{
-			SyncOnStart:       true,
-			PeriodicSyncHours: 2,
-		},
-		ApiServer: struct {
-			ListenAddr string "yaml:\"listenAddr\""
-		}{
-			ListenAddr: "0.0.0.0:8080",
-		},
+func lastStepOptions() error {
+	if autoFlag {
+		state, err := bld.State()
+		if err != nil {
+			return err
+		}
+		if cfg.AnySyncNamingNode.ListenAddr != "" && len(state.NamingNodes) == 0 {
+			if err = createServiceNode(nodeconf.NodeTypeNamingNode); err != nil {
+				return err
+			}
+		}
+		if cfg.AnySyncPaymentProcessingNode.ListenAddr != "" && len(state.PaymentNodes) == 0 {
+			if err = createServiceNode(nodeconf.NodeTypePaymentProcessingNode); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for {
+		fmt.Println()
+		prompt := &survey.Select{
+			Message: "Do you want to add more nodes?",
+			Options: []string{"No, generate configs", "Add sync-node", "Add file-node", "Add naming-node", "Add payment-processing-node"},
+			Default: "No, generate configs",
+		}
+
+		option := ""
+		if err := survey.AskOne(prompt, &option, survey.WithValidator(survey.Required)); err != nil {
+			return err
+		}
+		switch option {
+		case "Add sync-node":
+			if err := createSyncNode(0); err != nil {
+				return err
+			}
+		case "Add file-node":
+			if err := createFileNode(); err != nil {
+				return err
+			}
+		case "Add naming-node":
+			if err := createServiceNode(nodeconf.NodeTypeNamingNode); err != nil {
+				return err
+			}
+		case "Add payment-processing-node":
+			if err := createServiceNode(nodeconf.NodeTypePaymentProcessingNode); err != nil {
+				return err
+			}
+		default:
+			if strictFlag {
+				r, err := replication()
+				if err != nil {
+					return err
+				}
+				if warning := r.Warning(); warning != "" {
+					fmt.Printf("Insufficient replication: %s, add more sync nodes\n", warning)
+					continue
+				}
+			}
+			return nil
+		}
+		if err := saveSession(); err != nil {
+			return err
+		}
 	}
 }
 
-func defaultFileNode() FileNodeConfig {
-	return FileNodeConfig{
-		GeneralNodeConfig: func() GeneralNodeConfig {
-			cfg := defaultGeneralNode()
-			cfg.Drpc.Snappy = false
-			return cfg
-		}(),
-		DefaultLimit:      cfg.AnySyncFilenode.DefaultLimit,
-		S3Store: struct {
-			Endpoint       string "yaml:\"endpoint,omitempty\""
-			Bucket         string "yaml:\"bucket\""
-			IndexBucket    string "yaml:\"indexBucket\""
-			Region         string "yaml:\"region\""
-			Profile        string "yaml:\"profile\""
-			MaxThreads     int    "yaml:\"maxThreads\""
-			ForcePathStyle bool   "yaml:\"forcePathStyle\""
-		}{
-			MaxThreads:     16,
-			IndexBucket:    cfg.AnySyncFilenode.S3Store.IndexBucket,
-			ForcePathStyle: cfg.AnySyncFilenode.S3Store.ForcePathStyle,
-		},
-		Redis: struct {
-			IsCluster bool   "yaml:\"isCluster\""
-			URL       string "yaml:\"url\""
-		}{},
+// createNodeConfigFile writes the node config as is or rendered through the user template.
+// The file is readable by the owner only, it has the keys and the credentials of the node
+func createNodeConfigFile(tmpl *template.Template, node any, general builder.GeneralNodeConfig, ymlFilename string) error {
+	if tmpl == nil {
+		createConfigFile(node, ymlFilename, 0600)
+		return nil
+	}
+
+	bytes, err := builder.Render(tmpl, general.TemplateData(node, templateValues))
+	if err != nil {
+		return err
 	}
+	writeConfigFile(bytes, ymlFilename, 0600)
+	return nil
 }
 
-func createConfigFile(in interface{}, ymlFilename string) {
+func createConfigFile(in interface{}, ymlFilename string, perm os.FileMode) {
 	bytes, err := yaml.Marshal(in)
 	if err != nil {
 		panic(fmt.Sprintf("Could not marshal the keys: %v", err))
 	}
 
+	writeConfigFile(bytes, ymlFilename, perm)
+}
+
+// writeConfigFile writes the file with the permissions, the directories are created owner-only
+// as they hold the node configs
+func writeConfigFile(bytes []byte, ymlFilename string, perm os.FileMode) {
 	dir := filepath.Dir(ymlFilename)
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+	if err := os.MkdirAll(dir, 0700); err != nil {
 		panic(fmt.Sprintf("Could not create the directory: %v", err))
 	}
 
-	err = os.WriteFile(ymlFilename+".yml", bytes, os.ModePerm)
+	err := os.WriteFile(ymlFilename+".yml", bytes, perm)
 	if err != nil {
 		panic(fmt.Sprintf("Could not write the config to file: %v", err))
 	}
 }
-
-func init() {
-}
@@ -0,0 +1,448 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	layoutSingleHost = "Single host"
+	layoutMultiHost  = "Multiple hosts"
+
+	s3AWS   = "AWS S3"
+	s3Minio = "MinIO (self-hosted)"
+	s3Other = "Other S3-compatible storage"
+)
+
+var initTemplatePath string
+
+// templateSpec is what the init-template wizard knows about the network.
+// It is rendered into a commented template file for `create --auto`
+type templateSpec struct {
+	Layout            string
+	ExternalAddresses []string
+
+	Coordinator templateNode
+	Consensus   templateNode
+	SyncNodes   []templateNode
+	FileNode    templateNode
+	FileNodes   int
+
+	MongoHosts      []string
+	MongoReplicaSet string
+	MongoConnect    string
+
+	S3Provider       string
+	S3Endpoint       string
+	S3Region         string
+	S3Bucket         string
+	S3IndexBucket    string
+	S3ForcePathStyle bool
+	S3Profile        string
+	S3AccessKey      string
+	S3SecretKey      string
+
+	RedisURL string
+}
+
+type templateNode struct {
+	Listen    string
+	YamuxPort int
+	QuicPort  int
+}
+
+var initTemplate = &cobra.Command{
+	Use:          "init-template",
+	Short:        "Asks a few questions about the network and writes a commented template for `create --auto`",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := os.Stat(initTemplatePath); err == nil {
+			overwrite := false
+			err = survey.AskOne(&survey.Confirm{
+				Message: fmt.Sprintf("%s already exists, overwrite it?", initTemplatePath),
+			}, &overwrite)
+			if err != nil {
+				return err
+			}
+			if !overwrite {
+				return nil
+			}
+		}
+
+		spec, err := askTemplateSpec()
+		if err != nil {
+			return err
+		}
+
+		data, err := renderTemplateSpec(spec)
+		if err != nil {
+			return err
+		}
+
+		// the written file must be readable by create
+		var check DefaultConfig
+		if err = yaml.Unmarshal(data, &check); err != nil {
+			return fmt.Errorf("the generated template is invalid: %w", err)
+		}
+
+		if err = os.WriteFile(initTemplatePath, data, 0644); err != nil {
+			return fmt.Errorf("could not write the template: %w", err)
+		}
+		fmt.Printf("Template written to %s\n", initTemplatePath)
+		fmt.Printf("Review it and run `any-sync-network create --auto --c %s`\n", initTemplatePath)
+		return nil
+	},
+}
+
+func askTemplateSpec() (spec templateSpec, err error) {
+	if err = survey.AskOne(&survey.Select{
+		Message: "Where will the nodes run?",
+		Help:    "On a single host every node gets its own ports, on multiple hosts every node gets its own hostname",
+		Options: []string{layoutSingleHost, layoutMultiHost},
+		Default: layoutSingleHost,
+	}, &spec.Layout); err != nil {
+		return
+	}
+
+	counts := struct {
+		SyncCount string
+		FileCount string
+	}{}
+	if err = survey.Ask([]*survey.Question{
+		{
+			Name: "syncCount",
+			Prompt: &survey.Input{
+				Message: "How many sync nodes?",
+				Help:    "Every space is stored on 3 sync nodes, fewer nodes give weaker durability",
+				Default: "3",
+			},
+			Validate: validatePositive,
+		},
+		{
+			Name: "fileCount",
+			Prompt: &survey.Input{
+				Message: "How many file nodes?",
+				Default: "1",
+			},
+			Validate: validatePositive,
+		},
+	}, &counts); err != nil {
+		return
+	}
+	syncNodes, _ := strconv.Atoi(counts.SyncCount)
+	spec.FileNodes, _ = strconv.Atoi(counts.FileCount)
+
+	spec.Coordinator = templateNode{Listen: "any-sync-coordinator", YamuxPort: 4830, QuicPort: 5830}
+	spec.Consensus = templateNode{Listen: "any-sync-consensusnode", YamuxPort: 4530, QuicPort: 5530}
+	spec.FileNode = templateNode{Listen: "any-sync-filenode", YamuxPort: 4730, QuicPort: 5730}
+	for i := 0; i < syncNodes; i++ {
+		node := templateNode{Listen: "any-sync-node-" + strconv.Itoa(i+1), YamuxPort: 4430, QuicPort: 5430}
+		if spec.Layout == layoutSingleHost {
+			node.YamuxPort += i
+			node.QuicPort += i
+		}
+		spec.SyncNodes = append(spec.SyncNodes, node)
+	}
+
+	if spec.Layout == layoutSingleHost {
+		var addrs string
+		if err = survey.AskOne(&survey.Input{
+			Message: "Public hostnames or IPs of the host (comma separated)",
+			Help:    "Clients and other nodes connect to these addresses",
+			Default: "127.0.0.1",
+		}, &addrs, survey.WithValidator(survey.Required)); err != nil {
+			return
+		}
+		spec.ExternalAddresses = splitList(addrs)
+	} else {
+		if err = askHostname("coordinator", &spec.Coordinator); err != nil {
+			return
+		}
+		if err = askHostname("consensus node", &spec.Consensus); err != nil {
+			return
+		}
+		for i := range spec.SyncNodes {
+			if err = askHostname("sync node "+strconv.Itoa(i+1), &spec.SyncNodes[i]); err != nil {
+				return
+			}
+		}
+		if err = askHostname("file node", &spec.FileNode); err != nil {
+			return
+		}
+	}
+
+	var mongoHosts string
+	if err = survey.AskOne(&survey.Input{
+		Message: "MongoDB replica set hosts (comma separated host:port)",
+		Help:    "Leave empty to use a single mongodb://localhost:27017",
+	}, &mongoHosts); err != nil {
+		return
+	}
+	spec.MongoHosts = splitList(mongoHosts)
+	spec.MongoReplicaSet = "rs0"
+	spec.MongoConnect = "mongodb://localhost:27017"
+	if len(spec.MongoHosts) > 0 {
+		if err = survey.AskOne(&survey.Input{
+			Message: "MongoDB replica set name",
+			Default: spec.MongoReplicaSet,
+		}, &spec.MongoReplicaSet, survey.WithValidator(survey.Required)); err != nil {
+			return
+		}
+	}
+
+	if err = askS3(&spec); err != nil {
+		return
+	}
+
+	spec.RedisURL = "redis://localhost:6379?dial_timeout=3&read_timeout=6s"
+	if err = survey.AskOne(&survey.Input{
+		Message: "Redis URL",
+		Help:    "Redis with the Bloom module, cluster and Sentinel setups can be configured in the template",
+		Default: spec.RedisURL,
+	}, &spec.RedisURL, survey.WithValidator(survey.Required)); err != nil {
+		return
+	}
+	return
+}
+
+func askHostname(name string, node *templateNode) error {
+	return survey.AskOne(&survey.Input{
+		Message: fmt.Sprintf("Public hostname of the %s", name),
+		Default: node.Listen,
+	}, &node.Listen, survey.WithValidator(survey.Required))
+}
+
+func askS3(spec *templateSpec) (err error) {
+	if err = survey.AskOne(&survey.Select{
+		Message: "Which S3 provider do you use?",
+		Options: []string{s3AWS, s3Minio, s3Other},
+		Default: s3Minio,
+	}, &spec.S3Provider); err != nil {
+		return
+	}
+
+	spec.S3Region = "us-east-1"
+	spec.S3Bucket = "any-sync-files"
+	switch spec.S3Provider {
+	case s3Minio:
+		spec.S3Endpoint = "http://localhost:9000"
+		spec.S3ForcePathStyle = true
+	case s3Other:
+		spec.S3ForcePathStyle = true
+	}
+
+	var s3Qs []*survey.Question
+	if spec.S3Provider != s3AWS {
+		s3Qs = append(s3Qs, &survey.Question{
+			Name:     "s3Endpoint",
+			Prompt:   &survey.Input{Message: "S3 Endpoint", Default: spec.S3Endpoint},
+			Validate: survey.Required,
+		})
+	}
+	s3Qs = append(s3Qs,
+		&survey.Question{
+			Name:     "s3Region",
+			Prompt:   &survey.Input{Message: "S3 Region", Default: spec.S3Region},
+			Validate: survey.Required,
+		},
+		&survey.Question{
+			Name:     "s3Bucket",
+			Prompt:   &survey.Input{Message: "S3 Bucket", Default: spec.S3Bucket},
+			Validate: survey.Required,
+		},
+	)
+	if err = survey.Ask(s3Qs, spec); err != nil {
+		return
+	}
+	spec.S3IndexBucket = spec.S3Bucket
+
+	credentials := credentialsKeys
+	if spec.S3Provider == s3AWS {
+		credentials = credentialsProfile
+	}
+	if err = survey.AskOne(&survey.Select{
+		Message: "How should the file nodes authenticate to S3?",
+		Options: []string{credentialsProfile, credentialsKeys},
+		Default: credentials,
+	}, &credentials); err != nil {
+		return
+	}
+	if credentials == credentialsProfile {
+		spec.S3Profile = "default"
+		return survey.AskOne(&survey.Input{
+			Message: "S3 Profile",
+			Default: spec.S3Profile,
+		}, &spec.S3Profile, survey.WithValidator(survey.Required))
+	}
+
+	// secrets are kept out of the template, it is meant to be checked in
+	spec.S3AccessKey = "env:AWS_ACCESS_KEY_ID"
+	spec.S3SecretKey = "env:AWS_SECRET_ACCESS_KEY"
+	return survey.Ask([]*survey.Question{
+		{
+			Name: "s3AccessKey",
+			Prompt: &survey.Input{
+				Message: "S3 Access Key",
+				Help:    staticSecretHelp,
+				Default: spec.S3AccessKey,
+			},
+			Validate: survey.Required,
+		},
+		{
+			Name: "s3SecretKey",
+			Prompt: &survey.Input{
+				Message: "S3 Secret Key",
+				Help:    staticSecretHelp,
+				Default: spec.S3SecretKey,
+			},
+			Validate: survey.Required,
+		},
+	}, spec)
+}
+
+func validatePositive(ans interface{}) error {
+	n, err := strconv.Atoi(fmt.Sprint(ans))
+	if err != nil || n < 1 {
+		return fmt.Errorf("a positive number is required")
+	}
+	return nil
+}
+
+func splitList(s string) (list []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return
+}
+
+var templateSpecTmpl = template.Must(template.New("spec").Funcs(template.FuncMap{
+	"yaml": func(v any) (string, error) {
+		// flow style keeps scalars and lists on one line
+		node := &yaml.Node{}
+		if err := node.Encode(v); err != nil {
+			return "", err
+		}
+		node.Style = yaml.FlowStyle
+		out, err := yaml.Marshal(node)
+		return strings.TrimSpace(string(out)), err
+	},
+}).Parse(`# any-sync-network template, {{ .Layout }} layout.
+# Generated by ` + "`any-sync-network init-template`" + `, use it with ` + "`any-sync-network create --auto --c <this file>`" + `.
+
+# Public addresses added to every node next to its listen address.
+{{- if not .ExternalAddresses }}
+# Every node listens on its own public hostname, so none are needed.
+{{- end }}
+external-addresses: {{ yaml .ExternalAddresses }}
+
+# MongoDB replica set shared by coordinator and consensus nodes.
+# When hosts are set, the connect strings of the nodes are ignored and the URIs are built from these settings,
+# a replica set init script is written to etc/mongo-init.js.
+# password is literal, or env:NAME / file:/path read when the configs are generated, the configs get the plain value
+mongo:
+  hosts: {{ yaml .MongoHosts }}
+  replicaSet: {{ yaml .MongoReplicaSet }}
+  authDatabase: admin
+  user: ""
+  password: ""
+  writeConcern: majority
+
+# Coordinator: keeps the network configuration and the space statuses, requires MongoDB.
+any-sync-coordinator:
+  listen: {{ yaml .Coordinator.Listen }}
+  yamuxPort: {{ .Coordinator.YamuxPort }}
+  quicPort: {{ .Coordinator.QuicPort }}
+  mongo:
+    connect: {{ yaml .MongoConnect }}
+    database: coordinator
+  defaultLimits:
+    spaceMembersRead: 1000
+    spaceMembersWrite: 1000
+    sharedSpacesLimit: 1000
+
+# Consensus node: orders ACL changes, requires MongoDB.
+any-sync-consensusnode:
+  listen: {{ yaml .Consensus.Listen }}
+  yamuxPort: {{ .Consensus.YamuxPort }}
+  quicPort: {{ .Consensus.QuicPort }}
+  mongo:
+    connect: {{ yaml (printf "%s/?w=majority" .MongoConnect) }}
+    database: consensus
+
+# File nodes: store files in S3 and use Redis with the Bloom module.
+# Every next file node gets the next ports on the same listen address.
+any-sync-filenode:
+  count: {{ .FileNodes }}
+  listen: {{ yaml .FileNode.Listen }}
+  yamuxPort: {{ .FileNode.YamuxPort }}
+  quicPort: {{ .FileNode.QuicPort }}
+  # {{ .S3Provider }}
+  s3Store:
+    endpoint: {{ yaml .S3Endpoint }}
+    bucket: {{ yaml .S3Bucket }}
+    indexBucket: {{ yaml .S3IndexBucket }}
+    region: {{ yaml .S3Region }}
+    profile: {{ yaml .S3Profile }}
+    maxThreads: 16
+    forcePathStyle: {{ .S3ForcePathStyle }}
+    # static keys are used instead of the profile when set, values are literal,
+    # or env:NAME / file:/path read when the configs are generated, the configs get the plain values
+    credentials:
+      accessKey: {{ yaml .S3AccessKey }}
+      secretKey: {{ yaml .S3SecretKey }}
+  redis:
+    url: {{ yaml .RedisURL }}
+    isCluster: false
+    # set masterName and addrs to use Redis Sentinel instead of the url
+    sentinel:
+      masterName: ""
+      addrs: []
+      password: ""
+  # default storage limit of a space in bytes
+  defaultLimit: 1099511627776
+
+# Sync (tree) nodes: store the spaces, every space is kept on 3 of them.
+any-sync-node:
+  listen:
+{{- range .SyncNodes }}
+  - {{ yaml .Listen }}
+{{- end }}
+  yamuxPort:
+{{- range .SyncNodes }}
+  - {{ .YamuxPort }}
+{{- end }}
+  quicPort:
+{{- range .SyncNodes }}
+  - {{ .QuicPort }}
+{{- end }}
+
+# Optional nodes, with --auto they are created only when listen is set.
+# Only the common config sections are generated for them, add the service specific ones with --node-template
+any-sync-namingnode:
+  listen: ""
+  yamuxPort: 4930
+  quicPort: 5930
+
+any-sync-paymentprocessingnode:
+  listen: ""
+  yamuxPort: 4940
+  quicPort: 5940
+`))
+
+func renderTemplateSpec(spec templateSpec) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := templateSpecTmpl.Execute(&buf, spec); err != nil {
+		return nil, fmt.Errorf("could not render the template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
+)
+
+const (
+	mongoReplicaSet = "Replica set"
+	mongoConnect    = "Connect URI"
+)
+
+// askMongoSettings asks for the replica set shared by coordinator and consensus nodes and keeps it in the template
+func askMongoSettings() error {
+	defaultMode := mongoConnect
+	if len(cfg.Mongo.Hosts) > 0 {
+		defaultMode = mongoReplicaSet
+	}
+
+	mode := defaultMode
+	err := survey.AskOne(&survey.Select{
+		Message: "How do you want to configure MongoDB?",
+		Help:    "Coordinator and consensus nodes require MongoDB in replica-set mode",
+		Options: []string{mongoReplicaSet, mongoConnect},
+		Default: defaultMode,
+	}, &mode)
+	if err != nil {
+		return err
+	}
+	if mode == mongoConnect {
+		cfg.Mongo = builder.MongoSettings{}
+		return nil
+	}
+
+	var mongoQs = []*survey.Question{
+		{
+			Name: "hosts",
+			Prompt: &survey.Input{
+				Message: "Mongo replica set hosts (comma separated host:port)",
+				Default: strings.Join(cfg.Mongo.Hosts, ","),
+			},
+			Validate: survey.Required,
+		},
+		{
+			Name: "replicaSet",
+			Prompt: &survey.Input{
+				Message: "Mongo replica set name",
+				Default: cfg.Mongo.ReplicaSet,
+			},
+			Validate: survey.Required,
+		},
+		{
+			Name: "user",
+			Prompt: &survey.Input{
+				Message: "Mongo user",
+				Help:    "Leave empty if authentication is disabled",
+				Default: cfg.Mongo.User,
+			},
+		},
+		{
+			Name: "password",
+			Prompt: &survey.Password{
+				Message: "Mongo password",
+				Help:    secretHelp(cfg.Mongo.Password),
+			},
+		},
+		{
+			Name: "authDatabase",
+			Prompt: &survey.Input{
+				Message: "Mongo auth database",
+				Default: cfg.Mongo.AuthDatabase,
+			},
+		},
+		{
+			Name: "writeConcern",
+			Prompt: &survey.Input{
+				Message: "Mongo write concern",
+				Default: cfg.Mongo.WriteConcern,
+			},
+		},
+	}
+
+	answers := struct {
+		Hosts        string
+		ReplicaSet   string
+		User         string
+		Password     string
+		AuthDatabase string
+		WriteConcern string
+	}{
+		Hosts:        strings.Join(cfg.Mongo.Hosts, ","),
+		ReplicaSet:   cfg.Mongo.ReplicaSet,
+		User:         cfg.Mongo.User,
+		Password:     cfg.Mongo.Password,
+		AuthDatabase: cfg.Mongo.AuthDatabase,
+		WriteConcern: cfg.Mongo.WriteConcern,
+	}
+	if err = survey.Ask(mongoQs, &answers); err != nil {
+		return err
+	}
+	keepSecret(&answers.Password, cfg.Mongo.Password)
+
+	settings := builder.MongoSettings{
+		ReplicaSet:   answers.ReplicaSet,
+		AuthDatabase: answers.AuthDatabase,
+		User:         answers.User,
+		Password:     answers.Password,
+		WriteConcern: answers.WriteConcern,
+	}
+	for _, host := range strings.Split(answers.Hosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			settings.Hosts = append(settings.Hosts, host)
+		}
+	}
+	if err = settings.Validate(); err != nil {
+		return err
+	}
+	cfg.Mongo = settings
+	return nil
+}
+
+// mongoConnectURI returns the replica set URI if it is configured and the given connect string otherwise
+func mongoConnectURI(connect string) (string, error) {
+	if len(cfg.Mongo.Hosts) == 0 {
+		return connect, nil
+	}
+	settings := cfg.Mongo
+	var err error
+	if settings.Password, err = resolveSecret(settings.Password); err != nil {
+		return "", err
+	}
+	return settings.URI()
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/anyproto/any-sync-tools/anyconf/placement"
+)
+
+// replication returns how the spaces of the network being created will be replicated
+func replication() (r placement.Replication, err error) {
+	res, err := bld.Build()
+	if err != nil {
+		return
+	}
+	p, err := placement.New(res.Configuration)
+	if err != nil {
+		return
+	}
+	return p.Replication()
+}
+
+func checkReplication() error {
+	r, err := replication()
+	if err != nil {
+		return err
+	}
+	fmt.Println("\nReplication:")
+	for _, line := range r.Lines() {
+		fmt.Println(line)
+	}
+	if warning := r.Warning(); warning != "" {
+		if strictFlag {
+			return fmt.Errorf("insufficient replication: %s", warning)
+		}
+		fmt.Printf("\033[1mWarning:\033[0m %s\n", warning)
+	}
+	return nil
+}
@@ -8,6 +8,11 @@ import (
 
 var autoFlag bool
 var templatePath string
+var resumeFlag bool
+var sessionPath string
+var strictFlag bool
+var nodeTemplatePath string
+var keyProviderCommand string
 var rootCmd = &cobra.Command{
 	Use:   "anyconf",
 	Short: "Configuration builder for Any-Sync nodes.",
@@ -22,6 +27,25 @@ func Execute() {
 
 func init() {
 	rootCmd.AddCommand(create)
+	rootCmd.AddCommand(bundle)
+	rootCmd.AddCommand(verifyBundle)
+	rootCmd.AddCommand(initTemplate)
 	create.Flags().BoolVar(&autoFlag, "auto", false, "auto generation in non-interactive mode")
-	create.Flags().StringVar(&templatePath, "c", "./defaultTemplate.yml", "path to the template file")
+	create.Flags().StringVar(&templatePath, "c", "./defaultTemplate.yml", "path to the template file, its env: and file: credentials are read on this machine and written to the configs as plain values")
+	create.Flags().BoolVar(&resumeFlag, "resume", false, "continue an interrupted session")
+	create.Flags().StringVar(&sessionPath, "session", "./.any-sync-network-session.yml", "path to the session file")
+	create.Flags().StringVar(&nodeTemplatePath, "node-template", "", "path to a Go text/template to render every node config with")
+	create.Flags().BoolVar(&strictFlag, "strict", false, "fail if the tree nodes can't provide full replication")
+	create.Flags().StringVar(&keyProviderCommand, "key-provider", "", "command line of an external key provider, quoted like a shell one, the configs then get key references instead of private keys; pass it to bundle as well")
+
+	bundle.Flags().StringVar(&bundleDir, "dir", "./etc", "path to the generated configs")
+	bundle.Flags().StringVar(&bundlePath, "o", "./network-bundle.tar.gz", "path to the output bundle")
+	bundle.Flags().StringVar(&networkKeyPath, "network-key", "", "path to a file with the encoded network key (default: the coordinator signing key)")
+	bundle.Flags().StringVar(&keyProviderCommand, "key-provider", "", "command line of the key provider the configs were created with, it signs the manifest with the network key")
+
+	verifyBundle.Flags().StringVar(&bundlePath, "b", "./network-bundle.tar.gz", "path to the bundle")
+	verifyBundle.Flags().StringVar(&expectedNetworkId, "network-id", "", "expected network id, from a trusted source as the bundle can be signed by any key")
+	_ = verifyBundle.MarkFlagRequired("network-id")
+
+	initTemplate.Flags().StringVar(&initTemplatePath, "o", "./template.yml", "path to the template file to write")
 }
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+// The nodes take static credentials only. env:NAME and file:/path are read on this machine when the configs
+// are generated, so the configs, the session file and the bundles contain the plain values. Only the template keeps them
+const staticSecretHelp = "The static credential of the nodes: a literal value, or env:NAME / file:/path to read it on this machine when the configs are generated. " +
+	"The nodes can't resolve env: or file:, the configs get the plain value"
+
+// storedSecretHelp is the help of a password prompt with a value from the template, the prompt can't show it as the default
+const storedSecretHelp = staticSecretHelp + ". Leave empty to keep the template value"
+
+// secretHelp returns the help of a password prompt
+func secretHelp(stored string) string {
+	if stored != "" {
+		return storedSecretHelp
+	}
+	return staticSecretHelp
+}
+
+// requiredSecret requires the answer of a password prompt unless the template has the value
+func requiredSecret(stored string) survey.Validator {
+	if stored != "" {
+		return nil
+	}
+	return survey.Required
+}
+
+// keepSecret falls back to the template value if the password prompt was left empty
+func keepSecret(answer *string, stored string) {
+	if *answer == "" {
+		*answer = stored
+	}
+}
+
+// resolveSecret reads the static credential on this machine: env:NAME reads an environment variable
+// and file:/path a file, any other value is returned as is
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("could not read the secret: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return ref, nil
+}
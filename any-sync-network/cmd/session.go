@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	stepCoordinator = "coordinator"
+	stepConsensus   = "consensus"
+	stepSyncNodes   = "sync-nodes"
+	stepFileNode    = "file-node"
+	stepExtraNodes  = "extra-nodes"
+	stepConfigs     = "configs"
+	stepDone        = "done"
+)
+
+var steps = []string{stepCoordinator, stepConsensus, stepSyncNodes, stepFileNode, stepExtraNodes, stepConfigs, stepDone}
+
+// step is the next step of the create flow to run
+var step string
+
+var bld *builder.Builder
+
+// Session is the in-progress state of the create flow.
+// It is written to the session file after every step, so an interrupted run can be continued with --resume
+// in the same --auto mode
+type Session struct {
+	Step           string         `yaml:"step"`
+	Auto           bool           `yaml:"auto"`
+	Template       DefaultConfig  `yaml:"template"`
+	TemplateValues map[string]any `yaml:"templateValues,omitempty"`
+	Builder        builder.State  `yaml:"builder"`
+}
+
+func nextStep(s string) string {
+	for i, st := range steps {
+		if st == s && i+1 < len(steps) {
+			return steps[i+1]
+		}
+	}
+	return stepDone
+}
+
+func saveSession() error {
+	state, err := bld.State()
+	if err != nil {
+		return err
+	}
+
+	bytes, err := yaml.Marshal(Session{
+		Step:           step,
+		Auto:           autoFlag,
+		Template:       cfg,
+		TemplateValues: templateValues,
+		Builder:        state,
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal the session: %w", err)
+	}
+
+	// the session contains private keys, so keep it readable only by the owner
+	if err = os.WriteFile(sessionPath, bytes, 0600); err != nil {
+		return fmt.Errorf("could not write the session to file: %w", err)
+	}
+	return nil
+}
+
+// loadSession restores the session. autoSet is whether --auto is given, it must match the mode of the session then
+func loadSession(autoSet bool) error {
+	data, err := os.ReadFile(sessionPath)
+	if err != nil {
+		return fmt.Errorf("could not read the session file: %w", err)
+	}
+
+	var s Session
+	if err = yaml.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("the session file structure is wrong: %w", err)
+	}
+	if autoSet && autoFlag != s.Auto {
+		return fmt.Errorf("the session was started with --auto=%t, resume it in the same mode", s.Auto)
+	}
+
+	keyOpts, err := keyProviderOptions()
+	if err != nil {
+		return err
+	}
+	if bld, err = builder.Restore(s.Builder, keyOpts...); err != nil {
+		return fmt.Errorf("could not restore the session: %w", err)
+	}
+
+	step = s.Step
+	autoFlag = s.Auto
+	cfg = s.Template
+	templateValues = s.TemplateValues
+	return nil
+}
+
+func removeSession() {
+	if err := os.Remove(sessionPath); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Could not remove the session file %s: %v\n", sessionPath, err)
+	}
+}
+
+// keyProviderOptions returns the builder options of --key-provider, the keys are generated in process without it
+func keyProviderOptions() ([]builder.Option, error) {
+	if keyProviderCommand == "" {
+		return nil, nil
+	}
+	keys, err := builder.NewExecKeyProvider(keyProviderCommand)
+	if err != nil {
+		return nil, err
+	}
+	return []builder.Option{builder.WithKeyProvider(keys)}, nil
+}
@@ -2,14 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
 	"github.com/anyproto/any-sync-tools/anyconf/gen"
 	"github.com/anyproto/any-sync/accountservice"
 	"github.com/anyproto/any-sync/nodeconf"
 	"github.com/spf13/cobra"
-	"golang.org/x/exp/slices"
 	"gopkg.in/mgo.v2/bson"
-	"gopkg.in/yaml.v3"
-	"os"
 	"time"
 )
 
@@ -21,7 +19,10 @@ const (
 	addressFlag           = "address"
 )
 
-var validTypesOptions = []nodeconf.NodeType{nodeconf.NodeTypeTree, nodeconf.NodeTypeFile, nodeconf.NodeTypeConsensus, nodeconf.NodeTypeCoordinator}
+var validTypesOptions = gen.NodeTypes
+
+// typesUsage documents the node types and their key rules in the help of every --t flag
+var typesUsage = fmt.Sprintf("node type, one of %v. The coordinator signs with the network key and can't be combined with other types, other nodes sign with their peer key", validTypesOptions)
 
 type Nodes struct {
 	Nodes []nodeconf.Node `yaml:"nodes"`
@@ -31,92 +32,127 @@ type PrivateConf struct {
 	Account accountservice.Config `yaml:"account"`
 }
 
+// addResult is the result of add-node
+type addResult struct {
+	PeerId          string              `json:"peerId"`
+	Addresses       []string            `json:"addresses"`
+	Types           []nodeconf.NodeType `json:"types"`
+	Index           *uint32             `json:"index,omitempty"`
+	NetworkId       string              `json:"networkId"`
+	ConfigurationId string              `json:"configurationId"`
+	NodesFile       string              `json:"nodesFile"`
+	AccountFile     string              `json:"accountFile"`
+	Replication     replicationReport   `json:"replication"`
+}
+
 var addNode = &cobra.Command{
 	Use:   "add-node",
 	Short: "Add note to existing node list",
 	Args:  cobra.RangeArgs(0, 10),
-	Run: func(cmd *cobra.Command, args []string) {
-		nodesConfigPath, err := cmd.Flags().GetString(nodesPathFlag)
-		types, err := cmd.Flags().GetStringArray(typesFlag)
-		outputNodesPath, err := cmd.Flags().GetString(outputNodesPathFlag)
-		outputAccountPath, err := cmd.Flags().GetString(outputAccountPathFlag)
-		address, err := cmd.Flags().GetString(addressFlag)
-
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodesConfigPath, _ := cmd.Flags().GetString(nodesPathFlag)
+		types, _ := cmd.Flags().GetStringArray(typesFlag)
+		outputNodesPath, _ := cmd.Flags().GetString(outputNodesPathFlag)
+		outputAccountPath, _ := cmd.Flags().GetString(outputAccountPathFlag)
+		address, _ := cmd.Flags().GetString(addressFlag)
+		strict, _ := cmd.Flags().GetBool(strictFlag)
+		networkKeyPath, _ := cmd.Flags().GetString(networkKeyFlag)
+
+		nodesConfig, err := readNodesConfig(nodesConfigPath)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
-		if len(types) == 0 {
-			panic("You should specify at least one node type")
+		var addresses []string
+
+		nodeTypes, err := parseNodeTypes(types)
+		if err != nil {
+			return err
 		}
 
-		nodesConfig := nodeconf.Configuration{}
+		if address != "" {
+			addresses = append(addresses, address)
+		}
 
-		data, err := os.ReadFile(nodesConfigPath)
+		keys, err := newMnemonicKeys(cmd)
 		if err != nil {
-			panic("Couldn't read file")
+			return err
 		}
-
-		err = yaml.Unmarshal(data, &nodesConfig)
+		keyProvider, err := newKeyProvider(cmd)
 		if err != nil {
-			panic("The file structure is wrong")
+			return err
+		}
+		if keys != nil && networkKeyPath != "" {
+			return invalidInputf("--%s and --%s can't be used together, the network key is derived from the mnemonic", networkKeyFlag, mnemonicFlag)
 		}
 
-		var addresses []string
-
-		var nodeTypes []nodeconf.NodeType
-		for _, nodeType := range types {
-			nodeType := nodeconf.NodeType(nodeType)
-
-			if !slices.Contains(validTypesOptions, nodeType) {
-				panic(fmt.Errorf("wrong node 'type' parameter: '%s'", nodeType))
+		// a coordinator signs with the network key, without it the account would have no signing key
+		var netKey builder.Key
+		if networkKeyPath != "" {
+			if netKey, err = loadNetworkKeyOf(networkKeyPath, nodesConfig.NetworkId); err != nil {
+				return err
 			}
-
-			nodeTypes = append(nodeTypes, nodeType)
+		} else if keys == nil && gen.UsesNetworkKey(nodeTypes) {
+			return invalidInputf("a new coordinator signs with the network key, set --%s", networkKeyFlag)
 		}
 
-		if address != "" {
-			addresses = append(addresses, address)
+		var newConf nodeconf.Node
+		var accountConf accountservice.Config
+		if keys != nil {
+			if newConf, accountConf, err = keys.nodeConfig(0, addresses, nodeTypes, nodesConfig.NetworkId); err != nil {
+				return err
+			}
+			if _, findErr := findNode(nodesConfig, newConf.PeerId); findErr == nil {
+				return invalidInputf("node %s of index %d is already in the list, use recover-account to restore its account", newConf.PeerId, keys.index)
+			}
+		} else if newConf, accountConf, err = gen.GenNodeConfig(keyProvider, addresses, nodeTypes, netKey); err != nil {
+			return keyError(err)
 		}
-
-		newConf, accountConf, err := gen.GenNodeConfig(addresses, nodeTypes, nil)
 		nodesConfig.Nodes = append(nodesConfig.Nodes, newConf)
 		nodesConfig.Id = bson.NewObjectId().Hex()
 		nodesConfig.CreationTime = time.Now()
-		bytes, err := yaml.Marshal(nodesConfig)
-		if err != nil {
-			panic(fmt.Sprintf("could not marshal the keys: %v", err))
-		}
 
-		err = os.WriteFile(outputNodesPath, bytes, os.ModePerm)
-		if err != nil {
-			panic(fmt.Sprintf("could not write the config to file: %v", err))
+		res := addResult{
+			PeerId:          accountConf.PeerId,
+			Addresses:       newConf.Addresses,
+			Types:           newConf.Types,
+			NetworkId:       nodesConfig.NetworkId,
+			ConfigurationId: nodesConfig.Id,
+			NodesFile:       outputNodesPath,
+			AccountFile:     outputAccountPath,
 		}
-
-		privateConf := PrivateConf{
-			Account: accountConf,
+		if keys != nil {
+			res.Index = &keys.index
 		}
 
-		fmt.Println("Node created")
-		fmt.Printf("PeerId:\t%s\n", accountConf.PeerId)
-		fmt.Printf("ConfigurationId:\t%s\n", nodesConfig.Id)
-
-		bytes, err = yaml.Marshal(privateConf)
-		if err != nil {
-			panic(fmt.Sprintf("could not marshal the keys: %v", err))
+		if res.Replication, err = checkReplication(nodesConfig, strict); err != nil {
+			return err
+		}
+		if err = writeNodesConfig(nodesConfig, outputNodesPath); err != nil {
+			return err
 		}
 
-		err = os.WriteFile(outputAccountPath, bytes, os.ModePerm)
+		renderer, err := newAccountRenderer(cmd)
 		if err != nil {
-			panic(fmt.Sprintf("could not write the config to file: %v", err))
+			return err
 		}
+		if err = renderer.writeAccount(outputAccountPath, accountConf, nodesConfig); err != nil {
+			return err
+		}
+
+		report(res, func() {
+			fmt.Println("Node created")
+			fmt.Printf("PeerId:\t%s\n", accountConf.PeerId)
+			fmt.Printf("ConfigurationId:\t%s\n", nodesConfig.Id)
+		})
+		return nil
 	},
 }
 
 func init() {
 	addNode.Flags().String(nodesPathFlag, "old_nodes.yml", "Path to existing nodes yaml")
 
-	addNode.Flags().StringArray(typesFlag, []string{}, "fill this flag with one of three options [tree, file, coordinator]")
+	addNode.Flags().StringArray(typesFlag, []string{}, typesUsage)
 	addNode.MarkFlagRequired(typesFlag)
 
 	addNode.Flags().String(outputNodesPathFlag, "nodes.yml", "Path to output nodes yaml with a new node")
@@ -124,4 +160,13 @@ func init() {
 	addNode.Flags().String(addressFlag, "", "Address to node [optional]")
 
 	addNode.Flags().String(outputAccountPathFlag, "account.yml", "Path to output account + nodes yaml")
+
+	addTemplateFlags(addNode)
+
+	addNode.Flags().String(networkKeyFlag, "", "Path to a file with the encoded network key, needed to add a coordinator [optional]")
+
+	addMnemonicFlags(addNode)
+	addKeyProviderFlag(addNode)
+
+	addNode.Flags().Bool(strictFlag, false, "fail if the tree nodes can't provide full replication")
 }
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/anyproto/any-sync-tools/anyconf/nodelist"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const targetFormatFlag = "to"
+
+// convertResult is the result of convert
+type convertResult struct {
+	InputFormat     nodelist.Format `json:"inputFormat"`
+	OutputFormat    nodelist.Format `json:"outputFormat"`
+	Nodes           int             `json:"nodes"`
+	NetworkId       string          `json:"networkId"`
+	ConfigurationId string          `json:"configurationId,omitempty"`
+	GeneratedId     bool            `json:"generatedId,omitempty"`
+	OutputFile      string          `json:"outputFile"`
+}
+
+var convert = &cobra.Command{
+	Use:   "convert <input.yml>",
+	Short: "Convert a node list between the formats of the tools",
+	Long: "Reads a node list in any format (nodeconf, network, client, netcheck or a complete node config) " +
+		"and writes it in the requested one",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputPath, _ := cmd.Flags().GetString(outputNodesPathFlag)
+		format, _ := cmd.Flags().GetString(targetFormatFlag)
+
+		outputFormat := nodelist.Format(format)
+		if !slices.Contains(nodelist.Formats, outputFormat) {
+			return invalidInputf("wrong --%s %q, expected one of %v", targetFormatFlag, format, nodelist.Formats)
+		}
+
+		nodesConfig, inputFormat, err := nodelist.Load(args[0])
+		if err != nil {
+			return fileError(err)
+		}
+
+		res := convertResult{InputFormat: inputFormat, OutputFormat: outputFormat, OutputFile: outputPath}
+		if outputFormat != nodelist.FormatClient && nodesConfig.Id == "" {
+			nodesConfig.Id = bson.NewObjectId().Hex()
+			res.GeneratedId = true
+			printText("The input has no configuration id, new one is generated: %s\n", nodesConfig.Id)
+		}
+		if outputFormat == nodelist.FormatNodeconf && nodesConfig.CreationTime.IsZero() {
+			nodesConfig.CreationTime = time.Now()
+		}
+
+		if err = nodelist.Save(outputPath, nodesConfig, outputFormat); err != nil {
+			return fileError(err)
+		}
+
+		res.Nodes = len(nodesConfig.Nodes)
+		res.NetworkId = nodesConfig.NetworkId
+		if outputFormat != nodelist.FormatClient {
+			res.ConfigurationId = nodesConfig.Id
+		}
+		report(res, func() {
+			fmt.Printf("Converted %s to %s\n", inputFormat, outputFormat)
+			fmt.Printf("Nodes:\t%d\n", res.Nodes)
+			fmt.Printf("NetworkId:\t%s\n", res.NetworkId)
+			fmt.Printf("Output:\t%s\n", outputPath)
+		})
+		return nil
+	},
+}
+
+func init() {
+	convert.Flags().String(outputNodesPathFlag, "nodes.yml", "Path to output yaml")
+	convert.Flags().String(targetFormatFlag, string(nodelist.FormatNodeconf), fmt.Sprintf("Output format, one of %v", nodelist.Formats))
+}
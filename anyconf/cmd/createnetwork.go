@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
 	"github.com/anyproto/any-sync-tools/anyconf/gen"
+	"github.com/anyproto/any-sync/accountservice"
 	"github.com/anyproto/any-sync/nodeconf"
 	"github.com/anyproto/any-sync/util/crypto"
 	"github.com/spf13/cobra"
@@ -13,11 +15,20 @@ import (
 	"time"
 )
 
+// createNetworkResult is the result of create-network
+type createNetworkResult struct {
+	NetworkId       string `json:"networkId"`
+	ConfigurationId string `json:"configurationId"`
+	PeerId          string `json:"peerId"`
+	NodesFile       string `json:"nodesFile"`
+	AccountFile     string `json:"accountFile"`
+}
+
 var createNetwork = &cobra.Command{
 	Use:   "create-network",
 	Short: "Creates new network keys",
 	Args:  cobra.RangeArgs(0, 10),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		outputAccountPath, _ := cmd.Flags().GetString(outputAccountPathFlag)
 		outputNodesPath, _ := cmd.Flags().GetString(outputNodesPathFlag)
 		address, _ := cmd.Flags().GetString(addressFlag)
@@ -28,7 +39,7 @@ var createNetwork = &cobra.Command{
 			nodeType := nodeconf.NodeType(nodeType)
 
 			if !slices.Contains(validTypesOptions, nodeType) {
-				panic(fmt.Errorf("wrong node 'type' parameter: '%s'", nodeType))
+				return invalidInputf("wrong node 'type' parameter: '%s'", nodeType)
 			}
 
 			nodeTypes = append(nodeTypes, nodeType)
@@ -36,58 +47,90 @@ var createNetwork = &cobra.Command{
 		if !slices.Contains(nodeTypes, nodeconf.NodeTypeCoordinator) {
 			nodeTypes = append(nodeTypes, nodeconf.NodeTypeCoordinator)
 		}
-		netKey, _, _ := crypto.GenerateRandomEd25519KeyPair()
+		keys, err := newMnemonicKeys(cmd)
+		if err != nil {
+			return err
+		}
+		keyProvider, err := newKeyProvider(cmd)
+		if err != nil {
+			return err
+		}
 
 		var addresses []string
 		if address != "" {
 			addresses = append(addresses, address)
 		}
-		nc, ac, err := gen.GenNodeConfig(addresses, []nodeconf.NodeType{nodeconf.NodeTypeCoordinator}, netKey)
+
+		var networkId string
+		var nc nodeconf.Node
+		var ac accountservice.Config
+		if keys != nil {
+			var netKey crypto.PrivKey
+			if netKey, err = keys.networkKey(); err != nil {
+				return err
+			}
+			networkId = netKey.GetPublic().Network()
+			nc, ac, err = keys.nodeConfig(0, addresses, []nodeconf.NodeType{nodeconf.NodeTypeCoordinator}, "")
+		} else {
+			// with an external key provider the network key is kept by the provider too
+			var netKey builder.Key
+			if netKey, err = keyProvider.GenerateKey(); err != nil {
+				return keyError(err)
+			}
+			networkId = netKey.PubKey.Network()
+			nc, ac, err = gen.GenNodeConfig(keyProvider, addresses, []nodeconf.NodeType{nodeconf.NodeTypeCoordinator}, netKey)
+		}
 		if err != nil {
-			panic(fmt.Errorf("can't generate configs: %v", err))
+			return keyError(fmt.Errorf("can't generate configs: %w", err))
 		}
 
 		nodesConfig := nodeconf.Configuration{
 			Id:           bson.NewObjectId().Hex(),
-			NetworkId:    netKey.GetPublic().Network(),
+			NetworkId:    networkId,
 			Nodes:        []nodeconf.Node{nc},
 			CreationTime: time.Now(),
 		}
 
-		fmt.Println("Network created")
-		fmt.Printf("NetworkId:\t%s\n", netKey.GetPublic().Network())
-		fmt.Printf("ConfigurationId:\t%s\n", nodesConfig.Id)
-
-		bytes, err := yaml.Marshal(nodesConfig)
-		if err != nil {
-			panic(fmt.Sprintf("could not marshal the keys: %v", err))
-		}
-
-		err = os.WriteFile(outputNodesPath, bytes, os.ModePerm)
-		if err != nil {
-			panic(fmt.Sprintf("could not write the config to file: %v", err))
+		if err = writeNodesConfig(nodesConfig, outputNodesPath); err != nil {
+			return err
 		}
 
 		privateConf := PrivateConf{
 			Account: ac,
 		}
 
-		bytes, err = yaml.Marshal(privateConf)
+		bytes, err := yaml.Marshal(privateConf)
 		if err != nil {
-			panic(fmt.Sprintf("could not marshal the keys: %v", err))
+			return fmt.Errorf("could not marshal the keys: %w", err)
 		}
 
-		err = os.WriteFile(outputAccountPath, bytes, os.ModePerm)
+		// the account has the private keys
+		err = os.WriteFile(outputAccountPath, bytes, 0600)
 		if err != nil {
-			panic(fmt.Sprintf("could not write the config to file: %v", err))
+			return ioError(fmt.Errorf("could not write the config to file: %w", err))
 		}
 
+		res := createNetworkResult{
+			NetworkId:       nodesConfig.NetworkId,
+			ConfigurationId: nodesConfig.Id,
+			PeerId:          ac.PeerId,
+			NodesFile:       outputNodesPath,
+			AccountFile:     outputAccountPath,
+		}
+		report(res, func() {
+			fmt.Println("Network created")
+			fmt.Printf("NetworkId:\t%s\n", nodesConfig.NetworkId)
+			fmt.Printf("ConfigurationId:\t%s\n", nodesConfig.Id)
+		})
+		return nil
 	},
 }
 
 func init() {
-	createNetwork.Flags().StringArray(typesFlag, []string{}, "fill this flag with one of three options [tree, file, coordinator]")
+	createNetwork.Flags().StringArray(typesFlag, []string{}, typesUsage)
 	createNetwork.Flags().String(outputNodesPathFlag, "nodes.yml", "Path to output nodes yaml with a new node")
 	createNetwork.Flags().String(addressFlag, "", "Address to node [optional]")
 	createNetwork.Flags().String(outputAccountPathFlag, "account.yml", "Path to output account + nodes yaml")
+	addMnemonicFlags(createNetwork)
+	addKeyProviderFlag(createNetwork)
 }
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anyproto/any-sync-tools/anyconf/placement"
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+// nodeDiff is a node added, removed or changed between two node lists
+type nodeDiff struct {
+	PeerId string `json:"peerId"`
+	// Change is added, removed, types or addresses
+	Change string `json:"change"`
+	Old    any    `json:"old,omitempty"`
+	New    any    `json:"new,omitempty"`
+}
+
+// diffNode is an added or removed node in the diff
+type diffNode struct {
+	Addresses []string            `json:"addresses"`
+	Types     []nodeconf.NodeType `json:"types"`
+}
+
+func (d nodeDiff) String() string {
+	switch d.Change {
+	case "added":
+		node := d.New.(diffNode)
+		return fmt.Sprintf("+ %s %v %v", d.PeerId, node.Types, node.Addresses)
+	case "removed":
+		node := d.Old.(diffNode)
+		return fmt.Sprintf("- %s %v %v", d.PeerId, node.Types, node.Addresses)
+	case "addresses":
+		return fmt.Sprintf("~ %s addresses: %s -> %s", d.PeerId, strings.Join(d.Old.([]string), ","), strings.Join(d.New.([]string), ","))
+	}
+	return fmt.Sprintf("~ %s %s: %v -> %v", d.PeerId, d.Change, d.Old, d.New)
+}
+
+// spaceDiff is a space changing its tree nodes
+type spaceDiff struct {
+	SpaceId string `json:"spaceId"`
+	placement.Change
+}
+
+// diffPlacementResult is the result of diff-placement
+type diffPlacementResult struct {
+	Nodes     []nodeDiff          `json:"nodes"`
+	Rebalance placement.Rebalance `json:"rebalance"`
+	// Spaces are the changed spaces of the --space and --spaces ones
+	Spaces        []spaceDiff `json:"spaces,omitempty"`
+	CheckedSpaces int         `json:"checkedSpaces"`
+}
+
+var diffPlacement = &cobra.Command{
+	Use:   "diff-placement old.yml new.yml",
+	Short: "Show how spaces move between tree nodes when the node list changes",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		spaceIds, _ := cmd.Flags().GetStringArray(spaceFlag)
+		spacesPath, _ := cmd.Flags().GetString(spacesFlag)
+
+		oldConfig, err := readNodesConfig(args[0])
+		if err != nil {
+			return err
+		}
+		newConfig, err := readNodesConfig(args[1])
+		if err != nil {
+			return err
+		}
+		if spacesPath != "" {
+			fileIds, err := readSpaceIds(spacesPath)
+			if err != nil {
+				return err
+			}
+			spaceIds = append(spaceIds, fileIds...)
+		}
+
+		res := diffPlacementResult{Nodes: nodesDiff(oldConfig, newConfig), CheckedSpaces: len(spaceIds)}
+
+		oldP, err := placement.New(oldConfig)
+		if err != nil {
+			return invalidInput(err)
+		}
+		newP, err := placement.New(newConfig)
+		if err != nil {
+			return invalidInput(err)
+		}
+		if res.Rebalance, err = placement.Diff(oldP, newP); err != nil {
+			return invalidInput(err)
+		}
+
+		for _, spaceId := range spaceIds {
+			if c := placement.SpaceChange(oldP, newP, spaceId); c.Changed() {
+				res.Spaces = append(res.Spaces, spaceDiff{SpaceId: spaceId, Change: c})
+			}
+		}
+
+		report(res, func() {
+			fmt.Println("Nodes:")
+			for _, d := range res.Nodes {
+				fmt.Printf("  %s\n", d)
+			}
+			if len(res.Nodes) == 0 {
+				fmt.Println("  no changes")
+			}
+
+			r := res.Rebalance
+			fmt.Printf("\nPartitions: %d of %d (%.1f%%) change their tree nodes, %d partition replicas move\n",
+				r.ChangedPartitions, r.Partitions, r.ChangedFraction()*100, r.MovedReplicas)
+
+			if len(spaceIds) == 0 {
+				return
+			}
+			fmt.Println("\nSpaces:")
+			for _, s := range res.Spaces {
+				fmt.Printf("  %s\n", s.SpaceId)
+				for _, peerId := range s.Gained {
+					fmt.Printf("    + %s\n", peerId)
+				}
+				for _, peerId := range s.Lost {
+					fmt.Printf("    - %s\n", peerId)
+				}
+			}
+			fmt.Printf("  %d of %d spaces change their tree nodes\n", len(res.Spaces), len(spaceIds))
+		})
+		return nil
+	},
+}
+
+// nodesDiff returns the added, removed and changed nodes
+func nodesDiff(oldConfig, newConfig nodeconf.Configuration) (diffs []nodeDiff) {
+	oldNodes := make(map[string]nodeconf.Node, len(oldConfig.Nodes))
+	for _, node := range oldConfig.Nodes {
+		oldNodes[node.PeerId] = node
+	}
+	newNodes := make(map[string]nodeconf.Node, len(newConfig.Nodes))
+	for _, node := range newConfig.Nodes {
+		newNodes[node.PeerId] = node
+	}
+
+	for _, node := range newConfig.Nodes {
+		oldNode, ok := oldNodes[node.PeerId]
+		if !ok {
+			diffs = append(diffs, nodeDiff{PeerId: node.PeerId, Change: "added", New: diffNode{node.Addresses, node.Types}})
+			continue
+		}
+		if !slices.Equal(oldNode.Types, node.Types) {
+			diffs = append(diffs, nodeDiff{PeerId: node.PeerId, Change: "types", Old: oldNode.Types, New: node.Types})
+		}
+		if !slices.Equal(oldNode.Addresses, node.Addresses) {
+			diffs = append(diffs, nodeDiff{PeerId: node.PeerId, Change: "addresses", Old: oldNode.Addresses, New: node.Addresses})
+		}
+	}
+	for _, node := range oldConfig.Nodes {
+		if _, ok := newNodes[node.PeerId]; !ok {
+			diffs = append(diffs, nodeDiff{PeerId: node.PeerId, Change: "removed", Old: diffNode{node.Addresses, node.Types}})
+		}
+	}
+	return
+}
+
+func init() {
+	diffPlacement.Flags().StringArray(spaceFlag, []string{}, "Space id to show the replica changes for")
+	diffPlacement.Flags().String(spacesFlag, "", "Path to a file with space ids, one per line [optional]")
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
+	"github.com/anyproto/any-sync-tools/anyconf/gen"
+	"github.com/anyproto/any-sync-tools/anyconf/placement"
+	"github.com/anyproto/any-sync/accountservice"
+	"github.com/anyproto/any-sync/nodeconf"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const accountsDirFlag = "accounts"
+
+// editedNode is a node of the edit session
+type editedNode struct {
+	nodeconf.Node
+	// Account is set when the keys of the node were generated in the session, it is written on save
+	Account *accountservice.Config
+}
+
+// editSaveResult is the result of a save of the edit session
+type editSaveResult struct {
+	ConfigurationId string     `json:"configurationId"`
+	NodesFile       string     `json:"nodesFile"`
+	AccountFiles    []string   `json:"accountFiles,omitempty"`
+	Nodes           []nodeDiff `json:"nodes"`
+}
+
+// editSession keeps the edited node list apart from the UI
+type editSession struct {
+	saved       nodeconf.Configuration
+	nodes       []editedNode
+	keys        builder.KeyProvider
+	netKey      builder.Key
+	nodesPath   string
+	accountsDir string
+	renderer    accountRenderer
+	lastSave    *editSaveResult
+}
+
+func newEditSession(conf nodeconf.Configuration) *editSession {
+	s := &editSession{saved: conf}
+	for _, node := range conf.Nodes {
+		s.nodes = append(s.nodes, editedNode{Node: node})
+	}
+	return s
+}
+
+func (s *editSession) configuration() nodeconf.Configuration {
+	conf := s.saved
+	conf.Nodes = make([]nodeconf.Node, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		conf.Nodes = append(conf.Nodes, node.Node)
+	}
+	return conf
+}
+
+// problems validates the edited list, errors block saving and warnings don't
+func (s *editSession) problems() (errs, warnings []string) {
+	peerIds := map[string]bool{}
+	hasCoordinator := false
+	for _, node := range s.nodes {
+		if peerIds[node.PeerId] {
+			errs = append(errs, fmt.Sprintf("%s is listed twice", node.PeerId))
+		}
+		peerIds[node.PeerId] = true
+		if err := gen.ValidateTypes(node.Types); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", node.PeerId, err))
+		}
+		if node.HasType(nodeconf.NodeTypeCoordinator) {
+			hasCoordinator = true
+			if node.Account != nil && node.Account.SigningKey == "" {
+				errs = append(errs, fmt.Sprintf("%s: a new coordinator signs with the network key, set --%s", node.PeerId, networkKeyFlag))
+			}
+		}
+		if len(node.Addresses) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s has no addresses", node.PeerId))
+		}
+	}
+	if !hasCoordinator {
+		errs = append(errs, errNoCoordinator.Error())
+	}
+
+	if p, err := placement.New(s.configuration()); err == nil {
+		if r, err := p.Replication(); err == nil && r.Warning() != "" {
+			warnings = append(warnings, r.Warning())
+		}
+	}
+	return
+}
+
+// newNode generates the keys of a new node, coordinators sign with the network key if it is set
+func (s *editSession) newNode(types []nodeconf.NodeType, addresses []string) (editedNode, error) {
+	node, account, err := gen.GenNodeConfig(s.keys, addresses, types, s.netKey)
+	if err != nil {
+		return editedNode{}, keyError(err)
+	}
+	return editedNode{Node: node, Account: &account}, nil
+}
+
+// regenerateKeys gives the node a new identity, the old account of the node can't be used with the list anymore
+func (s *editSession) regenerateKeys(i int) error {
+	node, err := s.newNode(s.nodes[i].Types, s.nodes[i].Addresses)
+	if err != nil {
+		return err
+	}
+	s.nodes[i] = node
+	return nil
+}
+
+// update changes the types and addresses of the node. The account of new keys follows the types,
+// as a coordinator signs with the network key
+func (s *editSession) update(i int, types []nodeconf.NodeType, addresses []string) error {
+	node := &s.nodes[i]
+	if node.Account != nil {
+		peerKey, err := s.keys.PublicKey(node.Account.PeerKey)
+		if err != nil {
+			return keyError(err)
+		}
+		_, account, err := gen.NodeConfigFromKey(builder.Key{Ref: node.Account.PeerKey, PubKey: peerKey}, addresses, types, s.netKey)
+		if err != nil {
+			return keyError(err)
+		}
+		node.Account = &account
+	}
+	node.Types = types
+	node.Addresses = addresses
+	return nil
+}
+
+// save writes the list with a new id and creation time and the accounts of the nodes with new keys
+func (s *editSession) save() (res editSaveResult, err error) {
+	if errs, _ := s.problems(); len(errs) > 0 {
+		return res, invalidInputf("can't save: %s", errs[0])
+	}
+
+	conf := s.configuration()
+	conf.Id = bson.NewObjectId().Hex()
+	conf.CreationTime = time.Now()
+	if err = writeNodesConfig(conf, s.nodesPath); err != nil {
+		return
+	}
+	res = editSaveResult{ConfigurationId: conf.Id, NodesFile: s.nodesPath, Nodes: nodesDiff(s.saved, conf)}
+
+	for i, node := range s.nodes {
+		if node.Account == nil {
+			continue
+		}
+		if err = os.MkdirAll(s.accountsDir, os.ModePerm); err != nil {
+			return res, ioError(fmt.Errorf("could not create the accounts directory: %w", err))
+		}
+		path := filepath.Join(s.accountsDir, fmt.Sprintf("%s-account.yml", node.PeerId))
+		if err = s.renderer.writeAccount(path, *node.Account, conf); err != nil {
+			return
+		}
+		res.AccountFiles = append(res.AccountFiles, path)
+		s.nodes[i].Account = nil
+	}
+
+	s.saved = conf
+	s.lastSave = &res
+	return res, nil
+}
+
+var editCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit a node list in an interactive terminal UI",
+	Long: "Lists the nodes and lets you add, remove and change them or generate new keys. " +
+		"The list is validated on every change, on save a new configuration is written and the changes are shown",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodesConfigPath, _ := cmd.Flags().GetString(nodesPathFlag)
+		outputNodesPath, _ := cmd.Flags().GetString(outputNodesPathFlag)
+		accountsDir, _ := cmd.Flags().GetString(accountsDirFlag)
+		networkKeyPath, _ := cmd.Flags().GetString(networkKeyFlag)
+
+		nodesConfig, err := readNodesConfig(nodesConfigPath)
+		if err != nil {
+			return err
+		}
+
+		s := newEditSession(nodesConfig)
+		s.nodesPath = outputNodesPath
+		if s.nodesPath == "" {
+			s.nodesPath = nodesConfigPath
+		}
+		s.accountsDir = accountsDir
+		if s.keys, err = newKeyProvider(cmd); err != nil {
+			return err
+		}
+		if networkKeyPath != "" {
+			if s.netKey, err = loadNetworkKeyOf(networkKeyPath, nodesConfig.NetworkId); err != nil {
+				return err
+			}
+		}
+		if s.renderer, err = newAccountRenderer(cmd); err != nil {
+			return err
+		}
+
+		// keep stdout for the result with --format json
+		opts := []tea.ProgramOption{tea.WithAltScreen()}
+		if jsonOutput() {
+			opts = append(opts, tea.WithOutput(os.Stderr))
+		}
+		if _, err = tea.NewProgram(newEditModel(s), opts...).Run(); err != nil {
+			return fmt.Errorf("the terminal UI failed: %w", err)
+		}
+
+		report(s.lastSave, func() {
+			if s.lastSave == nil {
+				fmt.Println("No changes saved")
+				return
+			}
+			fmt.Println("Configuration saved")
+			fmt.Printf("ConfigurationId:\t%s\n", s.lastSave.ConfigurationId)
+			for _, d := range s.lastSave.Nodes {
+				fmt.Printf("  %s\n", d)
+			}
+			for _, path := range s.lastSave.AccountFiles {
+				fmt.Printf("Account:\t%s\n", path)
+			}
+		})
+		return nil
+	},
+}
+
+func init() {
+	editCmd.Flags().String(nodesPathFlag, nodesYaml, "Path to nodes yaml")
+	editCmd.Flags().String(outputNodesPathFlag, "", "Path to output nodes yaml [optional, the input file is overwritten by default]")
+	editCmd.Flags().String(accountsDirFlag, ".", "Directory to write the accounts of the nodes with new keys to")
+	editCmd.Flags().String(networkKeyFlag, "", "Path to a file with the encoded network key, needed to add coordinators [optional]")
+	addTemplateFlags(editCmd)
+	addKeyProviderFlag(editCmd)
+}
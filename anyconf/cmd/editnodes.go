@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/anyproto/any-sync-tools/anyconf/gen"
+	"github.com/anyproto/any-sync-tools/anyconf/nodelist"
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/yaml.v3"
+)
+
+const peerIdFlag = "peer"
+
+var errNoCoordinator = errors.New("the network must keep at least one coordinator node")
+
+// editResult is the result of remove-node and update-node
+type editResult struct {
+	PeerId          string              `json:"peerId"`
+	Addresses       []string            `json:"addresses,omitempty"`
+	Types           []nodeconf.NodeType `json:"types,omitempty"`
+	ConfigurationId string              `json:"configurationId"`
+	NodesFile       string              `json:"nodesFile"`
+	Replication     replicationReport   `json:"replication"`
+}
+
+var removeNode = &cobra.Command{
+	Use:   "remove-node",
+	Short: "Remove node from existing node list by peer id",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodesConfigPath, _ := cmd.Flags().GetString(nodesPathFlag)
+		outputNodesPath, _ := cmd.Flags().GetString(outputNodesPathFlag)
+		peerId, _ := cmd.Flags().GetString(peerIdFlag)
+		strict, _ := cmd.Flags().GetBool(strictFlag)
+
+		nodesConfig, err := readNodesConfig(nodesConfigPath)
+		if err != nil {
+			return err
+		}
+
+		idx, err := findNode(nodesConfig, peerId)
+		if err != nil {
+			return invalidInput(err)
+		}
+		nodesConfig.Nodes = slices.Delete(nodesConfig.Nodes, idx, idx+1)
+
+		res := editResult{PeerId: peerId, NodesFile: outputNodesPath}
+		if res.Replication, err = writeEditedNodesConfig(&nodesConfig, outputNodesPath, strict); err != nil {
+			return err
+		}
+		res.ConfigurationId = nodesConfig.Id
+
+		report(res, func() {
+			fmt.Println("Node removed")
+			fmt.Printf("PeerId:\t%s\n", peerId)
+			fmt.Printf("ConfigurationId:\t%s\n", nodesConfig.Id)
+		})
+		return nil
+	},
+}
+
+var updateNode = &cobra.Command{
+	Use:   "update-node",
+	Short: "Change addresses or types of a node in existing node list",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodesConfigPath, _ := cmd.Flags().GetString(nodesPathFlag)
+		outputNodesPath, _ := cmd.Flags().GetString(outputNodesPathFlag)
+		peerId, _ := cmd.Flags().GetString(peerIdFlag)
+		addresses, _ := cmd.Flags().GetStringArray(addressFlag)
+		types, _ := cmd.Flags().GetStringArray(typesFlag)
+		strict, _ := cmd.Flags().GetBool(strictFlag)
+
+		changeAddresses := cmd.Flags().Changed(addressFlag)
+		changeTypes := cmd.Flags().Changed(typesFlag)
+		if !changeAddresses && !changeTypes {
+			return invalidInputf("nothing to update, set --%s or --%s", addressFlag, typesFlag)
+		}
+
+		nodesConfig, err := readNodesConfig(nodesConfigPath)
+		if err != nil {
+			return err
+		}
+
+		idx, err := findNode(nodesConfig, peerId)
+		if err != nil {
+			return invalidInput(err)
+		}
+
+		if changeAddresses {
+			nodesConfig.Nodes[idx].Addresses = addresses
+		}
+		if changeTypes {
+			nodeTypes, err := parseNodeTypes(types)
+			if err != nil {
+				return err
+			}
+			nodesConfig.Nodes[idx].Types = nodeTypes
+		}
+
+		res := editResult{PeerId: peerId, Addresses: nodesConfig.Nodes[idx].Addresses, Types: nodesConfig.Nodes[idx].Types, NodesFile: outputNodesPath}
+		if res.Replication, err = writeEditedNodesConfig(&nodesConfig, outputNodesPath, strict); err != nil {
+			return err
+		}
+		res.ConfigurationId = nodesConfig.Id
+
+		report(res, func() {
+			fmt.Println("Node updated")
+			fmt.Printf("PeerId:\t%s\n", peerId)
+			fmt.Printf("Addresses:\t%v\n", res.Addresses)
+			fmt.Printf("Types:\t%v\n", res.Types)
+			fmt.Printf("ConfigurationId:\t%s\n", nodesConfig.Id)
+		})
+		return nil
+	},
+}
+
+// readNodesConfig reads the node list in any of the formats nodelist supports
+func readNodesConfig(path string) (nodesConfig nodeconf.Configuration, err error) {
+	if nodesConfig, _, err = nodelist.Load(path); err != nil {
+		return nodesConfig, fileError(fmt.Errorf("%s: %w", path, err))
+	}
+	return
+}
+
+func findNode(nodesConfig nodeconf.Configuration, peerId string) (int, error) {
+	if peerId == "" {
+		return -1, fmt.Errorf("you should specify the node with --%s", peerIdFlag)
+	}
+	for i, node := range nodesConfig.Nodes {
+		if node.PeerId == peerId {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("node with peer id %s is not found", peerId)
+}
+
+func parseNodeTypes(types []string) (nodeTypes []nodeconf.NodeType, err error) {
+	if len(types) == 0 {
+		return nil, invalidInputf("you should specify at least one node type")
+	}
+	for _, nodeType := range types {
+		nodeTypes = append(nodeTypes, nodeconf.NodeType(nodeType))
+	}
+	if err = gen.ValidateTypes(nodeTypes); err != nil {
+		return nil, invalidInput(err)
+	}
+	return
+}
+
+// writeEditedNodesConfig gives the edited configuration a new id and creation time and writes it
+func writeEditedNodesConfig(nodesConfig *nodeconf.Configuration, path string, strict bool) (r replicationReport, err error) {
+	hasCoordinator := slices.ContainsFunc(nodesConfig.Nodes, func(node nodeconf.Node) bool {
+		return node.HasType(nodeconf.NodeTypeCoordinator)
+	})
+	if !hasCoordinator {
+		return r, invalidInput(errNoCoordinator)
+	}
+
+	nodesConfig.Id = bson.NewObjectId().Hex()
+	nodesConfig.CreationTime = time.Now()
+
+	if r, err = checkReplication(*nodesConfig, strict); err != nil {
+		return
+	}
+	return r, writeNodesConfig(*nodesConfig, path)
+}
+
+// writeNodesConfig writes the configuration in the nodeconf format
+func writeNodesConfig(nodesConfig nodeconf.Configuration, path string) error {
+	bytes, err := yaml.Marshal(nodesConfig)
+	if err != nil {
+		return fmt.Errorf("could not marshal the nodes: %w", err)
+	}
+	if err = os.WriteFile(path, bytes, os.ModePerm); err != nil {
+		return ioError(fmt.Errorf("could not write the config to file: %w", err))
+	}
+	return nil
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{removeNode, updateNode} {
+		cmd.Flags().String(nodesPathFlag, "old_nodes.yml", "Path to existing nodes yaml")
+		cmd.Flags().String(outputNodesPathFlag, "nodes.yml", "Path to output nodes yaml")
+		cmd.Flags().String(peerIdFlag, "", "Peer id of the node")
+		cmd.MarkFlagRequired(peerIdFlag)
+		cmd.Flags().Bool(strictFlag, false, "fail if the tree nodes can't provide full replication")
+	}
+
+	updateNode.Flags().StringArray(addressFlag, []string{}, "New node addresses, replace the existing ones")
+	updateNode.Flags().StringArray(typesFlag, []string{}, "New node types, replace the existing ones, "+typesUsage)
+}
@@ -0,0 +1,448 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type editView int
+
+const (
+	listView editView = iota
+	formView
+	savedView
+)
+
+// form inputs
+const (
+	typesInput = iota
+	addressesInput
+)
+
+type editModel struct {
+	session  *editSession
+	view     editView
+	table    table.Model
+	viewport viewport.Model
+	inputs   []textinput.Model
+	focus    int
+	// editIdx is the edited node, -1 when a node is added
+	editIdx int
+	formErr string
+	status  string
+	dirty   bool
+	// confirmQuit is set after q with unsaved changes, the next q quits
+	confirmQuit bool
+	quitting    bool
+	width       int
+	height      int
+}
+
+var (
+	editTitleStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("86")).
+			MarginBottom(1)
+
+	editHelpStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("241")).
+			MarginTop(1)
+
+	editErrorStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("196")).
+			Bold(true)
+
+	editWarningStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("214"))
+
+	editStatusStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("245"))
+
+	editDividerStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("240"))
+)
+
+func newEditModel(s *editSession) editModel {
+	t := table.New(
+		table.WithColumns([]table.Column{
+			{Title: "#", Width: 4},
+			{Title: "Peer ID", Width: 54},
+			{Title: "Types", Width: 24},
+			{Title: "Addresses", Width: 40},
+			{Title: "Keys", Width: 6},
+		}),
+		table.WithFocused(true),
+		table.WithHeight(20),
+	)
+	t.SetStyles(editTableStyles())
+
+	inputs := make([]textinput.Model, 2)
+	inputs[typesInput] = textinput.New()
+	inputs[typesInput].Prompt = "Types:     "
+	inputs[typesInput].Placeholder = "tree"
+	inputs[addressesInput] = textinput.New()
+	inputs[addressesInput].Prompt = "Addresses: "
+	inputs[addressesInput].Placeholder = "host:4430,quic://host:5430"
+
+	m := editModel{session: s, table: t, inputs: inputs, viewport: viewport.New(80, 20)}
+	m.refreshRows()
+	return m
+}
+
+func (m *editModel) refreshRows() {
+	rows := make([]table.Row, len(m.session.nodes))
+	for i, node := range m.session.nodes {
+		keys := ""
+		if node.Account != nil {
+			keys = "new"
+		}
+		types := make([]string, 0, len(node.Types))
+		for _, t := range node.Types {
+			types = append(types, string(t))
+		}
+		rows[i] = table.Row{fmt.Sprint(i + 1), node.PeerId, strings.Join(types, ","), strings.Join(node.Addresses, ","), keys}
+	}
+	m.table.SetRows(rows)
+}
+
+func (m editModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m editModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		// leave room for the title, the problems and the help
+		m.table.SetHeight(max(msg.Height-14, 5))
+		m.viewport.Width = msg.Width
+		m.viewport.Height = max(msg.Height-8, 5)
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			m.quitting = true
+			return m, tea.Quit
+		}
+
+		switch m.view {
+		case listView:
+			return m.updateList(msg)
+		case formView:
+			return m.updateForm(msg)
+		case savedView:
+			switch msg.String() {
+			case "q":
+				m.quitting = true
+				return m, tea.Quit
+			case "esc":
+				m.view = listView
+				return m, nil
+			}
+			m.viewport, cmd = m.viewport.Update(msg)
+		}
+	}
+	return m, cmd
+}
+
+func (m editModel) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	idx := m.table.Cursor()
+	hasNode := idx >= 0 && idx < len(m.session.nodes)
+	m.status = ""
+	confirmQuit := m.confirmQuit
+	m.confirmQuit = false
+
+	switch msg.String() {
+	case "q":
+		if m.dirty && !confirmQuit {
+			m.confirmQuit = true
+			m.status = "The changes are not saved, press q again to quit without saving or s to save"
+			return m, nil
+		}
+		m.quitting = true
+		return m, tea.Quit
+
+	case "a":
+		return m.openForm(-1)
+
+	case "e", "enter":
+		if hasNode {
+			return m.openForm(idx)
+		}
+
+	case "d":
+		if hasNode {
+			peerId := m.session.nodes[idx].PeerId
+			m.session.nodes = append(m.session.nodes[:idx], m.session.nodes[idx+1:]...)
+			m.dirty = true
+			m.status = fmt.Sprintf("Removed %s", peerId)
+			m.refreshRows()
+			if m.table.Cursor() >= len(m.session.nodes) && len(m.session.nodes) > 0 {
+				m.table.SetCursor(len(m.session.nodes) - 1)
+			}
+		}
+
+	case "k":
+		if hasNode {
+			oldPeerId := m.session.nodes[idx].PeerId
+			if err := m.session.regenerateKeys(idx); err != nil {
+				m.status = editErrorStyle.Render(err.Error())
+				return m, nil
+			}
+			m.dirty = true
+			m.status = fmt.Sprintf("New keys for %s: %s, the old account can't be used anymore", oldPeerId, m.session.nodes[idx].PeerId)
+			m.refreshRows()
+		}
+
+	case "s":
+		res, err := m.session.save()
+		if err != nil {
+			m.status = editErrorStyle.Render(err.Error())
+			return m, nil
+		}
+		m.dirty = false
+		m.refreshRows()
+		m.viewport.SetContent(renderSaveResult(res))
+		m.viewport.GotoTop()
+		m.view = savedView
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+// openForm starts editing the node of the index or adding a new one if it is -1
+func (m editModel) openForm(idx int) (tea.Model, tea.Cmd) {
+	m.view = formView
+	m.editIdx = idx
+	m.focus = typesInput
+	m.inputs[typesInput].SetValue("")
+	m.inputs[addressesInput].SetValue("")
+	if idx >= 0 {
+		node := m.session.nodes[idx]
+		types := make([]string, 0, len(node.Types))
+		for _, t := range node.Types {
+			types = append(types, string(t))
+		}
+		m.inputs[typesInput].SetValue(strings.Join(types, ","))
+		m.inputs[addressesInput].SetValue(strings.Join(node.Addresses, ","))
+	}
+	m.inputs[addressesInput].Blur()
+	m.formErr = m.validateForm()
+	return m, m.inputs[typesInput].Focus()
+}
+
+func (m editModel) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.view = listView
+		return m, nil
+
+	case "tab", "shift+tab", "up", "down":
+		m.inputs[m.focus].Blur()
+		m.focus = (m.focus + 1) % len(m.inputs)
+		return m, m.inputs[m.focus].Focus()
+
+	case "enter":
+		if m.formErr != "" {
+			return m, nil
+		}
+		types, _ := parseNodeTypes(splitComma(m.inputs[typesInput].Value()))
+		addresses := splitComma(m.inputs[addressesInput].Value())
+		if m.editIdx < 0 {
+			node, err := m.session.newNode(types, addresses)
+			if err != nil {
+				m.formErr = err.Error()
+				return m, nil
+			}
+			m.session.nodes = append(m.session.nodes, node)
+			m.status = fmt.Sprintf("Added %s with new keys", node.PeerId)
+			m.refreshRows()
+			m.table.SetCursor(len(m.session.nodes) - 1)
+		} else {
+			if err := m.session.update(m.editIdx, types, addresses); err != nil {
+				m.formErr = err.Error()
+				return m, nil
+			}
+			m.status = fmt.Sprintf("Changed %s", m.session.nodes[m.editIdx].PeerId)
+			m.refreshRows()
+		}
+		m.dirty = true
+		m.view = listView
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.inputs[m.focus], cmd = m.inputs[m.focus].Update(msg)
+	m.formErr = m.validateForm()
+	return m, cmd
+}
+
+// validateForm checks the form on every key, so the problem is shown while typing
+func (m editModel) validateForm() string {
+	types := splitComma(m.inputs[typesInput].Value())
+	if _, err := parseNodeTypes(types); err != nil {
+		return err.Error()
+	}
+	for _, address := range splitComma(m.inputs[addressesInput].Value()) {
+		if strings.ContainsAny(address, " \t") {
+			return fmt.Sprintf("wrong address %q", address)
+		}
+	}
+	return ""
+}
+
+func (m editModel) View() string {
+	if m.quitting {
+		return ""
+	}
+
+	switch m.view {
+	case formView:
+		return m.renderForm()
+	case savedView:
+		return m.renderSaved()
+	}
+	return m.renderList()
+}
+
+func (m editModel) renderList() string {
+	var s strings.Builder
+
+	s.WriteString(editTitleStyle.Render(fmt.Sprintf("anyconf edit: %s", m.session.nodesPath)))
+	s.WriteString("\n")
+	s.WriteString(editStatusStyle.Render(fmt.Sprintf("NetworkId: %s • %d nodes", m.session.saved.NetworkId, len(m.session.nodes))))
+	s.WriteString("\n\n")
+
+	s.WriteString(m.table.View())
+	s.WriteString("\n")
+
+	errs, warnings := m.session.problems()
+	for _, e := range errs {
+		s.WriteString(editErrorStyle.Render("✗ " + e))
+		s.WriteString("\n")
+	}
+	for _, w := range warnings {
+		s.WriteString(editWarningStyle.Render("! " + w))
+		s.WriteString("\n")
+	}
+	if m.status != "" {
+		s.WriteString(editStatusStyle.Render(m.status))
+		s.WriteString("\n")
+	}
+
+	help := "↑/↓: navigate • a: add • e/Enter: edit • d: remove • k: new keys • s: save • q: quit"
+	s.WriteString(editHelpStyle.Render(help))
+
+	return s.String()
+}
+
+func (m editModel) renderForm() string {
+	var s strings.Builder
+
+	title := "Add node"
+	if m.editIdx >= 0 {
+		title = fmt.Sprintf("Edit node %s", m.session.nodes[m.editIdx].PeerId)
+	}
+	s.WriteString(editTitleStyle.Render(title))
+	s.WriteString("\n")
+
+	for _, input := range m.inputs {
+		s.WriteString(input.View())
+		s.WriteString("\n")
+	}
+	s.WriteString("\n")
+	s.WriteString(editStatusStyle.Render(fmt.Sprintf("Types: %v, comma separated", validTypesOptions)))
+	s.WriteString("\n")
+	if m.editIdx < 0 {
+		s.WriteString(editStatusStyle.Render("New keys are generated for the node, the account is written on save"))
+		s.WriteString("\n")
+	}
+	if m.formErr != "" {
+		s.WriteString(editErrorStyle.Render(m.formErr))
+		s.WriteString("\n")
+	}
+
+	help := "Tab: next field • Enter: apply • Esc: cancel"
+	s.WriteString(editHelpStyle.Render(help))
+
+	return s.String()
+}
+
+func (m editModel) renderSaved() string {
+	var s strings.Builder
+
+	s.WriteString(editTitleStyle.Render("Configuration saved"))
+	s.WriteString("\n")
+
+	divider := editDividerStyle.Render(strings.Repeat("─", 80))
+	s.WriteString(divider)
+	s.WriteString("\n")
+	s.WriteString(m.viewport.View())
+	s.WriteString("\n")
+	s.WriteString(divider)
+	s.WriteString("\n")
+
+	help := "↑/↓: scroll • Esc: back to the list • q: quit"
+	s.WriteString(editHelpStyle.Render(help))
+
+	return s.String()
+}
+
+func renderSaveResult(res editSaveResult) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "ConfigurationId: %s\n", res.ConfigurationId)
+	fmt.Fprintf(&s, "Nodes file: %s\n\n", res.NodesFile)
+	s.WriteString("Changes:\n")
+	for _, d := range res.Nodes {
+		fmt.Fprintf(&s, "  %s\n", d)
+	}
+	if len(res.Nodes) == 0 {
+		s.WriteString("  no changes\n")
+	}
+	if len(res.AccountFiles) > 0 {
+		s.WriteString("\nAccounts of the new keys:\n")
+		for _, path := range res.AccountFiles {
+			fmt.Fprintf(&s, "  %s\n", path)
+		}
+	}
+	return s.String()
+}
+
+func editTableStyles() table.Styles {
+	s := table.DefaultStyles()
+
+	s.Header = s.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color("240")).
+		BorderBottom(true).
+		Bold(true).
+		Foreground(lipgloss.Color("86"))
+
+	s.Selected = s.Selected.
+		Foreground(lipgloss.Color("229")).
+		Background(lipgloss.Color("57")).
+		Bold(false)
+
+	return s
+}
+
+// splitComma splits a comma separated list and drops the empty items
+func splitComma(s string) (items []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
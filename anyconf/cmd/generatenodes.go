@@ -1,98 +1,274 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
 	"github.com/anyproto/any-sync-tools/anyconf/gen"
 	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/anyproto/any-sync/util/crypto"
 	"github.com/spf13/cobra"
 	"golang.org/x/exp/slices"
-	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/yaml.v3"
 	"os"
-	"time"
+	"path/filepath"
+	"strings"
 )
 
 const (
 	addressesFlag    = "addresses"
 	debugAddressFlag = "d"
 	nodesYaml        = "nodes.yml"
+	clientYaml       = "client.yml"
+	nodeSpecFlag     = "node"
+	outputDirFlag    = "dir"
+	networkKeyFlag   = "network-key"
 )
 
+// generatedNode is a node written by generate-nodes
+type generatedNode struct {
+	Type       nodeconf.NodeType `json:"type"`
+	PeerId     string            `json:"peerId"`
+	ConfigFile string            `json:"configFile"`
+	Index      *uint32           `json:"index,omitempty"`
+}
+
+// generateResult is the result of generate-nodes
+type generateResult struct {
+	NetworkId       string            `json:"networkId"`
+	ConfigurationId string            `json:"configurationId"`
+	NodesFile       string            `json:"nodesFile"`
+	ClientFile      string            `json:"clientFile"`
+	Nodes           []generatedNode   `json:"nodes"`
+	Replication     replicationReport `json:"replication"`
+}
+
 var generateNodes = &cobra.Command{
 	Use:   "generate-nodes",
 	Short: "Generate nodes",
 	Args:  cobra.RangeArgs(0, 10),
-	Run: func(cmd *cobra.Command, args []string) {
-		addresses, err := cmd.Flags().GetStringArray(addressesFlag)
-		types, err := cmd.Flags().GetStringArray(typesFlag)
-		debugAddresses, err := cmd.Flags().GetStringArray(debugAddressFlag)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		specs, _ := cmd.Flags().GetStringArray(nodeSpecFlag)
+		types, _ := cmd.Flags().GetStringArray(typesFlag)
+		addresses, _ := cmd.Flags().GetStringArray(addressesFlag)
+		debugAddresses, _ := cmd.Flags().GetStringArray(debugAddressFlag)
+		outputDir, _ := cmd.Flags().GetString(outputDirFlag)
+		networkKeyPath, _ := cmd.Flags().GetString(networkKeyFlag)
+		strict, _ := cmd.Flags().GetBool(strictFlag)
 
 		var nodesParams []gen.NodeParameters
-		for i, nodeType := range types {
-			nodeType := nodeconf.NodeType(nodeType)
-
-			if !slices.Contains(validTypesOptions, nodeType) {
-				fmt.Println(nodeType)
-				panic("Wrong node 'type' parameter")
+		switch {
+		case len(specs) > 0 && len(types) > 0:
+			return invalidInputf("use either --%s or --%s", nodeSpecFlag, typesFlag)
+		case len(specs) > 0:
+			for _, spec := range specs {
+				nodeParams, err := parseNodeSpec(spec)
+				if err != nil {
+					return invalidInput(err)
+				}
+				nodesParams = append(nodesParams, nodeParams)
 			}
-
-			debugAddress := ""
-			if len(debugAddresses) > i {
-				debugAddress = debugAddresses[i]
+		case len(types) > 0:
+			// --addresses and --d are paired with --t by position
+			for i, nodeType := range types {
+				nodeParams := gen.NodeParameters{NodeType: nodeconf.NodeType(nodeType)}
+				if len(debugAddresses) > i {
+					nodeParams.DebugAddress = debugAddresses[i]
+				}
+				if len(addresses) > i {
+					nodeParams.Address = addresses[i]
+				}
+				nodesParams = append(nodesParams, nodeParams)
 			}
+		default:
+			return invalidInputf("you should describe the nodes with --%s", nodeSpecFlag)
+		}
+
+		keys, err := newMnemonicKeys(cmd)
+		if err != nil {
+			return err
+		}
 
-			grpcAddress := ""
-			if len(addresses) > i {
-				grpcAddress = addresses[i]
+		keyProvider, err := newKeyProvider(cmd)
+		if err != nil {
+			return err
+		}
+
+		// without a network key the builder generates one with the key provider
+		var netKey crypto.PrivKey
+		if networkKeyPath != "" {
+			netKey, err = loadNetworkKey(networkKeyPath)
+		} else if keys != nil {
+			netKey, err = keys.networkKey()
+		}
+		if err != nil {
+			return err
+		}
+
+		if keys != nil {
+			for i := range nodesParams {
+				if nodesParams[i].PeerKey, err = keys.peerKey(i); err != nil {
+					return err
+				}
 			}
+		}
 
-			nodeParams := gen.NodeParameters{
-				DebugAddress: debugAddress,
-				Address:      grpcAddress,
-				NodeType:     nodeType,
+		fullNodesConfig, err := gen.GenerateFullNodesConfigs(nodesParams, netKey, keyProvider)
+		if err != nil {
+			var keyErr *builder.KeyError
+			if errors.As(err, &keyErr) {
+				return keyError(fmt.Errorf("could not generate configs: %w", err))
 			}
+			return invalidInput(fmt.Errorf("could not generate configs: %w", err))
+		}
+		nodes := fullNodesConfig[0].Nodes
+		if !slices.ContainsFunc(nodes.Nodes, func(node nodeconf.Node) bool { return slices.Contains(node.Types, nodeconf.NodeTypeCoordinator) }) {
+			printText("Warning: the nodes have no coordinator, they can only join a network that has one\n")
+		}
+
+		res := generateResult{
+			NetworkId:       nodes.NetworkId,
+			ConfigurationId: nodes.Id,
+			NodesFile:       filepath.Join(outputDir, nodesYaml),
+			ClientFile:      filepath.Join(outputDir, clientYaml),
+		}
+		if res.Replication, err = checkReplication(nodes, strict); err != nil {
+			return err
+		}
 
-			nodesParams = append(nodesParams, nodeParams)
+		if err = os.MkdirAll(outputDir, os.ModePerm); err != nil {
+			return ioError(fmt.Errorf("could not create the output directory: %w", err))
 		}
 
-		nodesList, accountsList, err := gen.GenerateNodesConfigs(nodesParams)
-		nodes := nodeconf.Configuration{
-			Id:           bson.NewObjectId().Hex(),
-			NetworkId:    "",
-			Nodes:        nodesList,
-			CreationTime: time.Time{},
+		if err = writeNodesConfig(nodes, res.NodesFile); err != nil {
+			return err
 		}
 
-		nodesBytes, err := yaml.Marshal(nodes)
+		clientBytes, err := yaml.Marshal(gen.GenerateClientConfig(nodes))
 		if err != nil {
-			panic(fmt.Sprintf("could Marshal nodes: %v", err))
+			return fmt.Errorf("could Marshal client config: %w", err)
 		}
 
-		err = os.WriteFile(nodesYaml, nodesBytes, os.ModePerm)
+		// the client config has no keys, unlike the node configs
+		err = os.WriteFile(res.ClientFile, clientBytes, 0644)
 		if err != nil {
-			panic(fmt.Sprintf("could not write nodes.yml to file: %v", err))
+			return ioError(fmt.Errorf("could not write client.yml to file: %w", err))
 		}
 
-		for index, account := range accountsList {
-			pc := PrivateConf{Account: account}
+		renderer, err := newAccountRenderer(cmd)
+		if err != nil {
+			return err
+		}
 
-			accountBytes, err := yaml.Marshal(pc)
+		// every file is the complete config of the node
+		for i, info := range fullNodesConfig {
+			configBytes, err := renderer.renderConfig(info)
+			if err != nil {
+				return invalidInput(err)
+			}
 
-			accountFilePath := fmt.Sprintf("account%d.yml", index)
+			configFilePath := filepath.Join(outputDir, fmt.Sprintf("%s-%s.yml", info.NodeType, info.Account.PeerId))
 
-			err = os.WriteFile(accountFilePath, accountBytes, os.ModePerm)
+			err = os.WriteFile(configFilePath, configBytes, 0600)
 			if err != nil {
-				panic(fmt.Sprintf("could not write accountBytes to file: %v", err))
+				return ioError(fmt.Errorf("could not write the node config to file: %w", err))
+			}
+
+			node := generatedNode{Type: info.NodeType, PeerId: info.Account.PeerId, ConfigFile: configFilePath}
+			if keys != nil {
+				index := keys.index + uint32(i)
+				node.Index = &index
 			}
+			res.Nodes = append(res.Nodes, node)
 		}
+
+		report(res, func() {
+			fmt.Printf("NetworkId:\t%s\n", nodes.NetworkId)
+			fmt.Printf("ConfigurationId:\t%s\n", nodes.Id)
+			for _, node := range res.Nodes {
+				if node.Index != nil {
+					fmt.Printf("%s\t%s\tindex %d\n", node.Type, node.ConfigFile, *node.Index)
+				} else {
+					fmt.Printf("%s\t%s\n", node.Type, node.ConfigFile)
+				}
+			}
+		})
+		return nil
 	},
 }
 
+// parseNodeSpec parses a node description like tree,address=host:port,debug=host:port,db=/path
+func parseNodeSpec(spec string) (params gen.NodeParameters, err error) {
+	for i, part := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found && i == 0 {
+			key, value = "type", key
+		}
+		switch key {
+		case "type":
+			params.NodeType = nodeconf.NodeType(value)
+		case "address":
+			params.Address = value
+		case "debug":
+			params.DebugAddress = value
+		case "db":
+			params.DBPath = value
+		default:
+			return params, fmt.Errorf("wrong node spec '%s': unknown key '%s'", spec, key)
+		}
+	}
+	if params.NodeType == "" {
+		return params, fmt.Errorf("wrong node spec '%s': the type is not set", spec)
+	}
+	return params, gen.ValidateTypes([]nodeconf.NodeType{params.NodeType})
+}
+
+// loadNetworkKey reads the encoded network key from the file
+func loadNetworkKey(path string) (crypto.PrivKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ioError(fmt.Errorf("could not read the network key: %w", err))
+	}
+	netKey, err := crypto.DecodeKeyFromString(strings.TrimSpace(string(data)), crypto.UnmarshalEd25519PrivateKey, nil)
+	if err != nil {
+		return nil, keyError(fmt.Errorf("could not decode the network key: %w", err))
+	}
+	return netKey, nil
+}
+
+// loadNetworkKeyOf reads the network key of the file and checks that it belongs to the network
+func loadNetworkKeyOf(path, networkId string) (builder.Key, error) {
+	netKey, err := loadNetworkKey(path)
+	if err != nil {
+		return builder.Key{}, err
+	}
+	if network := netKey.GetPublic().Network(); network != networkId {
+		return builder.Key{}, keyError(fmt.Errorf("the network key belongs to network %s, not %s", network, networkId))
+	}
+	key, err := builder.LocalKey(netKey)
+	if err != nil {
+		return builder.Key{}, keyError(err)
+	}
+	return key, nil
+}
+
 func init() {
-	generateNodes.Flags().StringArray(typesFlag, []string{}, "fill this flag with one of three options [tree, file, coordinator]")
-	generateNodes.MarkFlagRequired(typesFlag)
+	generateNodes.Flags().StringArray(nodeSpecFlag, []string{}, "node spec: <type>[,address=host[:port]][,debug=host:port][,db=/path], "+typesUsage)
+
+	generateNodes.Flags().StringArray(typesFlag, []string{}, "positional node types, prefer --"+nodeSpecFlag+": "+typesUsage)
+
+	generateNodes.Flags().StringArray(debugAddressFlag, []string{}, "positional, prefer --"+nodeSpecFlag+": debug address of the node in the same position in --t")
+
+	generateNodes.Flags().StringArray(addressesFlag, []string{}, "positional, prefer --"+nodeSpecFlag+": address of the node in the same position in --t")
+
+	generateNodes.Flags().String(outputDirFlag, ".", "Directory to write the configs to")
+
+	generateNodes.Flags().String(networkKeyFlag, "", "Path to a file with the encoded network key [optional, it is derived from --mnemonic or a new key is generated by default]")
+
+	addMnemonicFlags(generateNodes)
+	addKeyProviderFlag(generateNodes)
 
-	generateNodes.Flags().StringArray(debugAddressFlag, []string{}, "fill this flag with specific debug address for node")
+	addTemplateFlags(generateNodes)
 
-	generateNodes.Flags().StringArray(addressesFlag, []string{}, "fill this flag with specific grpc address for node")
+	generateNodes.Flags().Bool(strictFlag, false, "fail if the tree nodes can't provide full replication")
 }
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
+	"github.com/spf13/cobra"
+)
+
+const keyProviderFlag = "key-provider"
+
+// newKeyProvider returns the external key provider of --key-provider or the in-process one
+func newKeyProvider(cmd *cobra.Command) (builder.KeyProvider, error) {
+	command, _ := cmd.Flags().GetString(keyProviderFlag)
+	if command == "" {
+		return builder.LocalKeyProvider{}, nil
+	}
+	if mnemonic, _ := cmd.Flags().GetString(mnemonicFlag); mnemonic != "" {
+		return nil, invalidInputf("--%s and --%s can't be used together, the keys of a mnemonic are derived in process", keyProviderFlag, mnemonicFlag)
+	}
+	keys, err := builder.NewExecKeyProvider(command)
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+	return keys, nil
+}
+
+func addKeyProviderFlag(cmd *cobra.Command) {
+	cmd.Flags().String(keyProviderFlag, "", "Command line of an external key provider, quoted like a shell one, the files then get key references instead of private keys [optional]")
+}
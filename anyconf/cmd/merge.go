@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/anyproto/any-sync-tools/anyconf/gen"
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	resolveFlag  = "resolve"
+	resolveUnion = "union"
+)
+
+// nodeConflict is a peer listed with different addresses or types in the inputs
+type nodeConflict struct {
+	PeerId string
+	// Nodes are the entries of the peer by input index, nil if the input doesn't list it
+	Nodes []*nodeconf.Node
+}
+
+// conflictEntry is the entry of a conflicting peer in one of the inputs
+type conflictEntry struct {
+	Input     int                 `json:"input"`
+	File      string              `json:"file"`
+	Addresses []string            `json:"addresses"`
+	Types     []nodeconf.NodeType `json:"types"`
+}
+
+type conflictReport struct {
+	PeerId  string          `json:"peerId"`
+	Entries []conflictEntry `json:"entries"`
+}
+
+// mergeResult is the result of merge
+type mergeResult struct {
+	Nodes           int                `json:"nodes"`
+	NetworkId       string             `json:"networkId"`
+	ConfigurationId string             `json:"configurationId,omitempty"`
+	NodesFile       string             `json:"nodesFile,omitempty"`
+	Conflicts       []conflictReport   `json:"conflicts,omitempty"`
+	Replication     *replicationReport `json:"replication,omitempty"`
+}
+
+var merge = &cobra.Command{
+	Use:   "merge <nodes1.yml> <nodes2.yml> [more.yml...]",
+	Short: "Merge node lists of one network into a new configuration",
+	Long: "Unions the nodes of the inputs by peer id. A peer listed with different addresses or types is a conflict, " +
+		"resolve it with --resolve <peerId>=<input number> to take the entry of that input (starting from 1) " +
+		"or --resolve <peerId>=union to join the addresses and types",
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputNodesPath, _ := cmd.Flags().GetString(outputNodesPathFlag)
+		resolveArgs, _ := cmd.Flags().GetStringArray(resolveFlag)
+		strict, _ := cmd.Flags().GetBool(strictFlag)
+
+		resolutions, err := parseResolutions(resolveArgs, len(args))
+		if err != nil {
+			return invalidInput(err)
+		}
+
+		inputs := make([]nodeconf.Configuration, 0, len(args))
+		for _, path := range args {
+			conf, err := readNodesConfig(path)
+			if err != nil {
+				return err
+			}
+			inputs = append(inputs, conf)
+		}
+
+		merged, conflicts, err := mergeNodesConfigs(inputs, resolutions)
+		if err != nil {
+			return invalidInput(err)
+		}
+		res := mergeResult{Nodes: len(merged.Nodes), NetworkId: merged.NetworkId}
+		if len(conflicts) > 0 {
+			for _, c := range conflicts {
+				conflict := conflictReport{PeerId: c.PeerId}
+				for i, node := range c.Nodes {
+					if node != nil {
+						conflict.Entries = append(conflict.Entries, conflictEntry{Input: i + 1, File: args[i], Addresses: node.Addresses, Types: node.Types})
+					}
+				}
+				res.Conflicts = append(res.Conflicts, conflict)
+			}
+			report(res, func() {
+				for _, c := range res.Conflicts {
+					fmt.Printf("Conflict for %s:\n", c.PeerId)
+					for _, e := range c.Entries {
+						fmt.Printf("  %d %s: addresses %v, types %v\n", e.Input, e.File, e.Addresses, e.Types)
+					}
+				}
+			})
+			return invalidInputf("%d conflict(s) are not resolved, use --%s <peerId>=<input number>|%s", len(conflicts), resolveFlag, resolveUnion)
+		}
+
+		replication, err := writeEditedNodesConfig(&merged, outputNodesPath, strict)
+		if err != nil {
+			return err
+		}
+		res.ConfigurationId = merged.Id
+		res.NodesFile = outputNodesPath
+		res.Replication = &replication
+
+		report(res, func() {
+			fmt.Println("Node lists merged")
+			fmt.Printf("Nodes:\t%d\n", len(merged.Nodes))
+			fmt.Printf("NetworkId:\t%s\n", merged.NetworkId)
+			fmt.Printf("ConfigurationId:\t%s\n", merged.Id)
+		})
+		return nil
+	},
+}
+
+// parseResolutions parses <peerId>=<input number>|union, the input number is converted to the index
+func parseResolutions(args []string, inputs int) (map[string]string, error) {
+	resolutions := make(map[string]string, len(args))
+	for _, arg := range args {
+		peerId, value, ok := strings.Cut(arg, "=")
+		if !ok || peerId == "" {
+			return nil, fmt.Errorf("wrong --%s %q, expected <peerId>=<input number>|%s", resolveFlag, arg, resolveUnion)
+		}
+		if value != resolveUnion {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > inputs {
+				return nil, fmt.Errorf("wrong --%s %q, input number must be from 1 to %d", resolveFlag, arg, inputs)
+			}
+			value = strconv.Itoa(n - 1)
+		}
+		resolutions[peerId] = value
+	}
+	return resolutions, nil
+}
+
+// mergeNodesConfigs unions the nodes by peer id in the order they first appear.
+// The conflicts without a resolution are returned and the merged configuration is incomplete then
+func mergeNodesConfigs(inputs []nodeconf.Configuration, resolutions map[string]string) (merged nodeconf.Configuration, conflicts []nodeConflict, err error) {
+	merged.NetworkId = inputs[0].NetworkId
+	for i, conf := range inputs[1:] {
+		if conf.NetworkId != merged.NetworkId {
+			return merged, nil, fmt.Errorf("network ids differ: %q in input 1, %q in input %d", merged.NetworkId, conf.NetworkId, i+2)
+		}
+	}
+
+	var peerIds []string
+	entries := make(map[string][]*nodeconf.Node)
+	for i, conf := range inputs {
+		for j := range conf.Nodes {
+			node := &conf.Nodes[j]
+			if _, ok := entries[node.PeerId]; !ok {
+				peerIds = append(peerIds, node.PeerId)
+				entries[node.PeerId] = make([]*nodeconf.Node, len(inputs))
+			}
+			entries[node.PeerId][i] = node
+		}
+	}
+
+	for _, peerId := range peerIds {
+		nodes := entries[peerId]
+		resolution, resolved := resolutions[peerId]
+		if !resolved {
+			if !sameNodeEntries(nodes) {
+				conflicts = append(conflicts, nodeConflict{PeerId: peerId, Nodes: nodes})
+				continue
+			}
+			resolution = resolveUnion
+		}
+
+		node, err := resolveNode(peerId, nodes, resolution)
+		if err != nil {
+			return merged, nil, err
+		}
+		merged.Nodes = append(merged.Nodes, node)
+	}
+
+	for peerId := range resolutions {
+		if _, ok := entries[peerId]; !ok {
+			return merged, nil, fmt.Errorf("--%s is set for %s which isn't in the inputs", resolveFlag, peerId)
+		}
+	}
+	return merged, conflicts, nil
+}
+
+func resolveNode(peerId string, nodes []*nodeconf.Node, resolution string) (node nodeconf.Node, err error) {
+	if resolution != resolveUnion {
+		idx, _ := strconv.Atoi(resolution)
+		if nodes[idx] == nil {
+			return node, fmt.Errorf("input %d doesn't list %s", idx+1, peerId)
+		}
+		return *nodes[idx], nil
+	}
+
+	node.PeerId = peerId
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		for _, address := range n.Addresses {
+			if !slices.Contains(node.Addresses, address) {
+				node.Addresses = append(node.Addresses, address)
+			}
+		}
+		for _, t := range n.Types {
+			if !slices.Contains(node.Types, t) {
+				node.Types = append(node.Types, t)
+			}
+		}
+	}
+	if err = gen.ValidateTypes(node.Types); err != nil {
+		return node, fmt.Errorf("union of %s: %w", peerId, err)
+	}
+	return node, nil
+}
+
+// sameNodeEntries reports whether all inputs listing the peer agree on its addresses and types
+func sameNodeEntries(nodes []*nodeconf.Node) bool {
+	var first *nodeconf.Node
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		if first == nil {
+			first = node
+			continue
+		}
+		if !sameStrings(node.Addresses, first.Addresses) || !sameTypes(node.Types, first.Types) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameStrings(actual, expected []string) bool {
+	if len(actual) != len(expected) {
+		return false
+	}
+	for _, s := range expected {
+		if !slices.Contains(actual, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	merge.Flags().String(outputNodesPathFlag, "nodes.yml", "Path to output nodes yaml")
+	merge.Flags().StringArray(resolveFlag, []string{}, "Resolve a conflict: <peerId>=<input number> or <peerId>="+resolveUnion)
+	merge.Flags().Bool(strictFlag, false, "fail if the tree nodes can't provide full replication")
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
+	"github.com/anyproto/any-sync-tools/anyconf/gen"
+	"github.com/anyproto/any-sync/accountservice"
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/anyproto/any-sync/util/crypto"
+	"github.com/spf13/cobra"
+)
+
+const (
+	mnemonicFlag        = "mnemonic"
+	indexFlag           = "index"
+	networkKeyIndexFlag = "network-key-index"
+)
+
+// mnemonicKeys derives the node keys and the network key from the mnemonic of the operator.
+// The nodes get the indexes starting from index, the network key has its own index
+type mnemonicKeys struct {
+	mnemonic        crypto.Mnemonic
+	index           uint32
+	networkKeyIndex uint32
+}
+
+// newMnemonicKeys reads the mnemonic flags, it returns nil if --mnemonic is not set
+func newMnemonicKeys(cmd *cobra.Command) (*mnemonicKeys, error) {
+	path, _ := cmd.Flags().GetString(mnemonicFlag)
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ioError(fmt.Errorf("could not read the mnemonic: %w", err))
+	}
+	keys := &mnemonicKeys{mnemonic: crypto.Mnemonic(strings.Join(strings.Fields(string(data)), " "))}
+	if _, err = keys.mnemonic.Seed(); err != nil {
+		return nil, keyError(fmt.Errorf("wrong mnemonic in %s: %w", path, err))
+	}
+	keys.index, _ = cmd.Flags().GetUint32(indexFlag)
+	keys.networkKeyIndex, _ = cmd.Flags().GetUint32(networkKeyIndexFlag)
+	return keys, nil
+}
+
+// peerKey derives the key of the node number n of the command
+func (k *mnemonicKeys) peerKey(n int) (crypto.PrivKey, error) {
+	index := k.index + uint32(n)
+	if index == k.networkKeyIndex {
+		return nil, invalidInputf("index %d is used by the network key, set another --%s or --%s", index, indexFlag, networkKeyIndexFlag)
+	}
+	key, err := gen.DeriveKey(k.mnemonic, index)
+	return key, keyError(err)
+}
+
+func (k *mnemonicKeys) networkKey() (crypto.PrivKey, error) {
+	key, err := gen.DeriveKey(k.mnemonic, k.networkKeyIndex)
+	return key, keyError(err)
+}
+
+// nodeConfig derives the keys of the node number n. Coordinators sign with the derived network key,
+// it must be the key of networkId unless networkId is empty
+func (k *mnemonicKeys) nodeConfig(n int, addresses []string, types []nodeconf.NodeType, networkId string) (nc nodeconf.Node, ac accountservice.Config, err error) {
+	peerKey, err := k.peerKey(n)
+	if err != nil {
+		return
+	}
+	var netKey builder.Key
+	if gen.UsesNetworkKey(types) {
+		var netPrivKey crypto.PrivKey
+		if netPrivKey, err = k.networkKey(); err != nil {
+			return
+		}
+		if networkId != "" && netPrivKey.GetPublic().Network() != networkId {
+			err = keyError(fmt.Errorf("the network key %d belongs to network %s, not %s", k.networkKeyIndex, netPrivKey.GetPublic().Network(), networkId))
+			return
+		}
+		if netKey, err = builder.LocalKey(netPrivKey); err != nil {
+			err = keyError(err)
+			return
+		}
+	}
+	localPeerKey, err := builder.LocalKey(peerKey)
+	if err != nil {
+		err = keyError(err)
+		return
+	}
+	if nc, ac, err = gen.NodeConfigFromKey(localPeerKey, addresses, types, netKey); err != nil {
+		err = keyError(err)
+	}
+	return
+}
+
+func addMnemonicFlags(cmd *cobra.Command) {
+	cmd.Flags().String(mnemonicFlag, "", "Path to a file with a BIP39 mnemonic to derive the keys from instead of generating random ones [optional]")
+	cmd.Flags().Uint32(indexFlag, 1, "Derivation index of the (first) node key, every next node gets the next index")
+	cmd.Flags().Uint32(networkKeyIndexFlag, 0, "Derivation index of the network key")
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatFlag = "format"
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// exit codes of anyconf, automation tells the failures apart by them
+const (
+	exitFailed       = 1
+	exitInvalidInput = 2
+	exitIO           = 3
+	exitKey          = 4
+)
+
+type errorKind string
+
+const (
+	// kindFailed is a check that didn't pass, e.g. verify-account
+	kindFailed       errorKind = "failed"
+	kindInvalidInput errorKind = "invalid_input"
+	kindIO           errorKind = "io"
+	kindKey          errorKind = "key"
+)
+
+var exitCodes = map[errorKind]int{
+	kindFailed:       exitFailed,
+	kindInvalidInput: exitInvalidInput,
+	kindIO:           exitIO,
+	kindKey:          exitKey,
+}
+
+// cmdError is an error of a command with its kind, the kind gives the exit code
+type cmdError struct {
+	kind errorKind
+	err  error
+}
+
+func (e *cmdError) Error() string {
+	return e.err.Error()
+}
+
+func (e *cmdError) Unwrap() error {
+	return e.err
+}
+
+func newCmdError(kind errorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	var ce *cmdError
+	if errors.As(err, &ce) {
+		return err
+	}
+	return &cmdError{kind: kind, err: err}
+}
+
+func checkFailed(format string, args ...any) error {
+	return newCmdError(kindFailed, fmt.Errorf(format, args...))
+}
+
+func invalidInput(err error) error {
+	return newCmdError(kindInvalidInput, err)
+}
+
+func invalidInputf(format string, args ...any) error {
+	return invalidInput(fmt.Errorf(format, args...))
+}
+
+func ioError(err error) error {
+	return newCmdError(kindIO, err)
+}
+
+func keyError(err error) error {
+	return newCmdError(kindKey, err)
+}
+
+// fileError classifies an error of reading a file: the file system errors are I/O, the rest is a wrong content
+func fileError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return ioError(err)
+	}
+	return invalidInput(err)
+}
+
+// errorKindOf returns the kind of the error, errors without a kind come from cobra parsing the arguments
+func errorKindOf(err error) errorKind {
+	var ce *cmdError
+	if errors.As(err, &ce) {
+		return ce.kind
+	}
+	return kindInvalidInput
+}
+
+// errorReport is the json form of an error
+type errorReport struct {
+	Kind     errorKind `json:"kind"`
+	Message  string    `json:"message"`
+	ExitCode int       `json:"exitCode"`
+}
+
+// jsonReport is the only document written to stdout with --format json
+type jsonReport struct {
+	OK     bool         `json:"ok"`
+	Result any          `json:"result,omitempty"`
+	Error  *errorReport `json:"error,omitempty"`
+}
+
+// cmdResult is the result of the command, it is written on exit with --format json
+var cmdResult any
+
+func jsonOutput() bool {
+	flag := rootCmd.PersistentFlags().Lookup(formatFlag)
+	return flag != nil && flag.Value.String() == formatJSON
+}
+
+// report sets the result of the command. With --format json it is written on exit, otherwise text prints it
+func report(result any, text func()) {
+	if jsonOutput() {
+		cmdResult = result
+		return
+	}
+	text()
+}
+
+// printText prints progress lines, they are dropped with --format json as the result has the same data
+func printText(format string, args ...any) {
+	if !jsonOutput() {
+		fmt.Printf(format, args...)
+	}
+}
+
+func checkFormatFlag(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString(formatFlag)
+	if output != formatText && output != formatJSON {
+		return invalidInputf("wrong --%s %q, expected %s or %s", formatFlag, output, formatText, formatJSON)
+	}
+	return nil
+}
+
+// exit writes the result or the error and returns the exit code
+func exit(err error) int {
+	code := 0
+	if err != nil {
+		code = exitCodes[errorKindOf(err)]
+	}
+
+	if !jsonOutput() {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return code
+	}
+
+	r := jsonReport{OK: err == nil, Result: cmdResult}
+	if err != nil {
+		r.Error = &errorReport{Kind: errorKindOf(err), Message: err.Error(), ExitCode: code}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(r); encErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not write the json output: %v\n", encErr)
+		return exitIO
+	}
+	return code
+}
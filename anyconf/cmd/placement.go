@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anyproto/any-sync-tools/anyconf/placement"
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/spf13/cobra"
+)
+
+const (
+	spaceFlag    = "space"
+	spacesFlag   = "spaces"
+	simulateFlag = "simulate"
+)
+
+// spacePlacement is the partition and the responsible tree nodes of a space
+type spacePlacement struct {
+	SpaceId   string   `json:"spaceId"`
+	Partition int      `json:"partition"`
+	Peers     []string `json:"peers"`
+}
+
+// loadReport is the distribution of the simulated spaces over the tree nodes
+type loadReport struct {
+	Spaces    int            `json:"spaces"`
+	TreeNodes int            `json:"treeNodes"`
+	Ideal     float64        `json:"ideal"`
+	Peers     map[string]int `json:"peers"`
+}
+
+// placementResult is the result of placement
+type placementResult struct {
+	Spaces []spacePlacement `json:"spaces,omitempty"`
+	Load   *loadReport      `json:"load,omitempty"`
+}
+
+var placementCmd = &cobra.Command{
+	Use:   "placement",
+	Short: "Show tree nodes responsible for spaces",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodesConfigPath, _ := cmd.Flags().GetString(nodesPathFlag)
+		spaceIds, _ := cmd.Flags().GetStringArray(spaceFlag)
+		spacesPath, _ := cmd.Flags().GetString(spacesFlag)
+		simulate, _ := cmd.Flags().GetInt(simulateFlag)
+
+		nodesConfig, err := readNodesConfig(nodesConfigPath)
+		if err != nil {
+			return err
+		}
+		p, err := placement.New(nodesConfig)
+		if err != nil {
+			return invalidInput(err)
+		}
+		if len(p.TreePeers()) == 0 {
+			return invalidInputf("the configuration has no tree nodes")
+		}
+
+		if spacesPath != "" {
+			fileIds, err := readSpaceIds(spacesPath)
+			if err != nil {
+				return err
+			}
+			spaceIds = append(spaceIds, fileIds...)
+		}
+		if len(spaceIds) == 0 && simulate == 0 {
+			return invalidInputf("nothing to show, set --%s, --%s or --%s", spaceFlag, spacesFlag, simulateFlag)
+		}
+
+		var res placementResult
+		for _, spaceId := range spaceIds {
+			res.Spaces = append(res.Spaces, spacePlacement{SpaceId: spaceId, Partition: p.Partition(spaceId), Peers: p.SpacePeers(spaceId)})
+		}
+		if simulate > 0 {
+			load := newLoadReport(p, randomSpaceIds(simulate))
+			res.Load = &load
+		}
+
+		report(res, func() {
+			for _, s := range res.Spaces {
+				fmt.Printf("%s\tpartition %d\t%s\n", s.SpaceId, s.Partition, strings.Join(s.Peers, ", "))
+			}
+			if res.Load != nil {
+				if len(res.Spaces) > 0 {
+					fmt.Println()
+				}
+				res.Load.print()
+			}
+		})
+		return nil
+	},
+}
+
+// readSpaceIds reads space ids from a file, one per line. Empty lines and lines starting with # are skipped
+func readSpaceIds(path string) (spaceIds []string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ioError(fmt.Errorf("couldn't read file: %w", err))
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		spaceIds = append(spaceIds, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, ioError(fmt.Errorf("couldn't read file: %w", err))
+	}
+	return
+}
+
+// randomSpaceIds generates space ids with random replication keys
+func randomSpaceIds(n int) []string {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	spaceIds := make([]string, n)
+	for i := range spaceIds {
+		spaceIds[i] = fmt.Sprintf("simulated%d.%x", i, rnd.Uint64())
+	}
+	return spaceIds
+}
+
+func newLoadReport(p *placement.Placement, spaceIds []string) loadReport {
+	load := p.Load(spaceIds)
+	replicas := nodeconf.ReplicationFactor
+	if len(load) < replicas {
+		replicas = len(load)
+	}
+	return loadReport{
+		Spaces:    len(spaceIds),
+		TreeNodes: len(load),
+		Ideal:     float64(len(spaceIds)*replicas) / float64(len(load)),
+		Peers:     load,
+	}
+}
+
+func (r loadReport) print() {
+	peerIds := make([]string, 0, len(r.Peers))
+	for peerId := range r.Peers {
+		peerIds = append(peerIds, peerId)
+	}
+	sort.Strings(peerIds)
+
+	fmt.Printf("Simulated %d spaces on %d tree nodes, ideal load: %.0f spaces per node\n", r.Spaces, r.TreeNodes, r.Ideal)
+	for _, peerId := range peerIds {
+		fmt.Printf("  %s: %d spaces (%.1f%% of ideal)\n", peerId, r.Peers[peerId], float64(r.Peers[peerId])/r.Ideal*100)
+	}
+}
+
+func init() {
+	placementCmd.Flags().String(nodesPathFlag, nodesYaml, "Path to nodes yaml")
+	placementCmd.Flags().StringArray(spaceFlag, []string{}, "Space id to show the responsible tree nodes for")
+	placementCmd.Flags().String(spacesFlag, "", "Path to a file with space ids, one per line [optional]")
+	placementCmd.Flags().Int(simulateFlag, 0, "Number of random spaces to simulate the load distribution with [optional]")
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/spf13/cobra"
+)
+
+// recoverResult is the result of recover-account
+type recoverResult struct {
+	PeerId      string              `json:"peerId"`
+	Types       []nodeconf.NodeType `json:"types"`
+	Index       uint32              `json:"index"`
+	AccountFile string              `json:"accountFile"`
+}
+
+var recoverAccount = &cobra.Command{
+	Use:   "recover-account",
+	Short: "Restore the account file of a node from the mnemonic its keys were derived from",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodesConfigPath, _ := cmd.Flags().GetString(nodesPathFlag)
+		outputAccountPath, _ := cmd.Flags().GetString(outputAccountPathFlag)
+		types, _ := cmd.Flags().GetStringArray(typesFlag)
+
+		keys, err := newMnemonicKeys(cmd)
+		if err != nil {
+			return err
+		}
+		if keys == nil {
+			return invalidInputf("you should specify the mnemonic with --%s", mnemonicFlag)
+		}
+
+		var nodesConfig nodeconf.Configuration
+		if nodesConfigPath != "" {
+			if nodesConfig, err = readNodesConfig(nodesConfigPath); err != nil {
+				return err
+			}
+		}
+
+		peerKey, err := keys.peerKey(0)
+		if err != nil {
+			return err
+		}
+		peerId := peerKey.GetPublic().PeerId()
+
+		// the types of the node list win over --t, as the list is what the network runs with
+		var node nodeconf.Node
+		if idx, findErr := findNode(nodesConfig, peerId); findErr == nil {
+			node = nodesConfig.Nodes[idx]
+		} else if nodesConfigPath != "" {
+			return keyError(fmt.Errorf("node %s of index %d is not in %s", peerId, keys.index, nodesConfigPath))
+		} else if node.Types, err = parseNodeTypes(types); err != nil {
+			return invalidInputf("without --%s the node types should be set with --%s: %v", nodesPathFlag, typesFlag, err)
+		}
+
+		_, accountConf, err := keys.nodeConfig(0, node.Addresses, node.Types, nodesConfig.NetworkId)
+		if err != nil {
+			return err
+		}
+
+		renderer, err := newAccountRenderer(cmd)
+		if err != nil {
+			return err
+		}
+		if err = renderer.writeAccount(outputAccountPath, accountConf, nodesConfig); err != nil {
+			return err
+		}
+
+		res := recoverResult{PeerId: peerId, Types: node.Types, Index: keys.index, AccountFile: outputAccountPath}
+		report(res, func() {
+			fmt.Println("Account recovered")
+			fmt.Printf("PeerId:\t%s\n", peerId)
+			fmt.Printf("Types:\t%v\n", node.Types)
+		})
+		return nil
+	},
+}
+
+func init() {
+	recoverAccount.Flags().String(nodesPathFlag, "", "Path to nodes yaml to take the node types from [optional]")
+	recoverAccount.Flags().StringArray(typesFlag, []string{}, "Node types if --n is not set, "+typesUsage)
+	recoverAccount.Flags().String(outputAccountPathFlag, "account.yml", "Path to output account + nodes yaml")
+	addTemplateFlags(recoverAccount)
+	addMnemonicFlags(recoverAccount)
+}
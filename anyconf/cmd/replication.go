@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"github.com/anyproto/any-sync-tools/anyconf/placement"
+	"github.com/anyproto/any-sync/nodeconf"
+)
+
+const strictFlag = "strict"
+
+// replicationReport is the replication of the written configuration
+type replicationReport struct {
+	placement.Replication
+	Warning string `json:"warning,omitempty"`
+}
+
+// checkReplication prints how many replicas the spaces of the configuration get.
+// It returns an error if the replication is not full and strict is set
+func checkReplication(conf nodeconf.Configuration, strict bool) (r replicationReport, err error) {
+	p, err := placement.New(conf)
+	if err != nil {
+		return r, invalidInput(err)
+	}
+	if r.Replication, err = p.Replication(); err != nil {
+		return r, invalidInput(err)
+	}
+	for _, line := range r.Lines() {
+		printText("%s\n", line)
+	}
+	if r.Warning = r.Replication.Warning(); r.Warning != "" {
+		if strict {
+			return r, invalidInputf("insufficient replication: %s", r.Warning)
+		}
+		printText("Warning: %s\n", r.Warning)
+	}
+	return r, nil
+}
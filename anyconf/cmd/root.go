@@ -9,18 +9,36 @@ import (
 var rootCmd = &cobra.Command{
 	Use:   "anyconf",
 	Short: "Tool to generate and manage configs",
-	Long:  ``,
+	Long: "Tool to generate and manage configs.\n\n" +
+		"Exit codes: 1 a check failed, 2 invalid input, 3 I/O error, 4 key error",
+	PersistentPreRunE: checkFormatFlag,
+	SilenceErrors:     true,
+	SilenceUsage:      true,
 }
 
 func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	_, err := rootCmd.ExecuteC()
+	if code := exit(err); code != 0 {
+		os.Exit(code)
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().String(formatFlag, formatText, "Output format: text or json, json writes one document with the result or the error")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return invalidInput(err)
+	})
+
 	rootCmd.AddCommand(addNode)
+	rootCmd.AddCommand(removeNode)
+	rootCmd.AddCommand(updateNode)
+	rootCmd.AddCommand(placementCmd)
+	rootCmd.AddCommand(diffPlacement)
+	rootCmd.AddCommand(verifyAccount)
+	rootCmd.AddCommand(recoverAccount)
+	rootCmd.AddCommand(convert)
+	rootCmd.AddCommand(merge)
+	rootCmd.AddCommand(editCmd)
 	rootCmd.AddCommand(generateNodes)
 	rootCmd.AddCommand(createNetwork)
 }
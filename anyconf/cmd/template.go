@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
+	"github.com/anyproto/any-sync-tools/anyconf/gen"
+	"github.com/anyproto/any-sync/accountservice"
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	nodeTemplateFlag = "node-template"
+	valuesFlag       = "values"
+)
+
+// accountRenderer writes account files either as PrivateConf or through the user template
+type accountRenderer struct {
+	tmpl   *template.Template
+	values map[string]any
+}
+
+func newAccountRenderer(cmd *cobra.Command) (r accountRenderer, err error) {
+	tmplPath, _ := cmd.Flags().GetString(nodeTemplateFlag)
+	valuesPath, _ := cmd.Flags().GetString(valuesFlag)
+
+	if tmplPath != "" {
+		if r.tmpl, err = builder.LoadTemplate(tmplPath); err != nil {
+			return r, fileError(fmt.Errorf("could not load the node template: %w", err))
+		}
+	}
+	if valuesPath != "" {
+		data, err := os.ReadFile(valuesPath)
+		if err != nil {
+			return r, ioError(fmt.Errorf("could not read the template values: %w", err))
+		}
+		if err = yaml.Unmarshal(data, &r.values); err != nil {
+			return r, invalidInput(fmt.Errorf("the template values structure is wrong: %w", err))
+		}
+	}
+	return
+}
+
+func (r accountRenderer) render(account accountservice.Config, nodesConfig nodeconf.Configuration) ([]byte, error) {
+	privateConf := PrivateConf{
+		Account: account,
+	}
+	if r.tmpl == nil {
+		return yaml.Marshal(privateConf)
+	}
+	return builder.Render(r.tmpl, builder.NewTemplateData(account, builder.NetworkFromConfiguration(nodesConfig), privateConf, r.values))
+}
+
+// writeAccount renders the account file and writes it
+func (r accountRenderer) writeAccount(path string, account accountservice.Config, nodesConfig nodeconf.Configuration) error {
+	bytes, err := r.render(account, nodesConfig)
+	if err != nil {
+		return invalidInput(fmt.Errorf("could not render the account: %w", err))
+	}
+	// the account has the private keys
+	if err = os.WriteFile(path, bytes, 0600); err != nil {
+		return ioError(fmt.Errorf("could not write the account to file: %w", err))
+	}
+	return nil
+}
+
+// renderConfig writes the complete node config as is or through the user template
+func (r accountRenderer) renderConfig(info gen.NodeConfigInfo) ([]byte, error) {
+	if r.tmpl == nil {
+		return yaml.Marshal(info.Config)
+	}
+	return builder.Render(r.tmpl, info.General.TemplateData(info.Config, r.values))
+}
+
+func addTemplateFlags(cmd *cobra.Command) {
+	cmd.Flags().String(nodeTemplateFlag, "", "Path to a Go text/template to render account files with [optional]")
+	cmd.Flags().String(valuesFlag, "", "Path to a yaml file with values for the node template [optional]")
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
+	"github.com/anyproto/any-sync-tools/anyconf/gen"
+	"github.com/anyproto/any-sync/accountservice"
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/anyproto/any-sync/util/crypto"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+const accountPathFlag = "account"
+
+// accountFile is an account file or a complete node config, the network list is optional
+type accountFile struct {
+	Account accountservice.Config `yaml:"account"`
+	Network *struct {
+		NetworkId string          `yaml:"networkId"`
+		Nodes     []nodeconf.Node `yaml:"nodes"`
+	} `yaml:"network,omitempty"`
+}
+
+// accountCheck is a single line of the verify-account report
+type accountCheck struct {
+	Name    string
+	Err     error
+	Skipped string
+}
+
+func (c accountCheck) String() string {
+	switch {
+	case c.Skipped != "":
+		return fmt.Sprintf("SKIP\t%s: %s", c.Name, c.Skipped)
+	case c.Err != nil:
+		return fmt.Sprintf("FAIL\t%s: %v", c.Name, c.Err)
+	}
+	return fmt.Sprintf("PASS\t%s", c.Name)
+}
+
+// MarshalJSON writes the check with its status, the message is the error or the reason to skip
+func (c accountCheck) MarshalJSON() ([]byte, error) {
+	r := struct {
+		Name    string `json:"name"`
+		Status  string `json:"status"`
+		Message string `json:"message,omitempty"`
+	}{Name: c.Name, Status: "pass"}
+	switch {
+	case c.Skipped != "":
+		r.Status, r.Message = "skip", c.Skipped
+	case c.Err != nil:
+		r.Status, r.Message = "fail", c.Err.Error()
+	}
+	return json.Marshal(r)
+}
+
+// verifyResult is the result of verify-account
+type verifyResult struct {
+	PeerId string         `json:"peerId"`
+	Valid  bool           `json:"valid"`
+	Checks []accountCheck `json:"checks"`
+}
+
+var verifyAccount = &cobra.Command{
+	Use:   "verify-account",
+	Short: "Check the keys of an account file and its place in the node list",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accountPath, _ := cmd.Flags().GetString(accountPathFlag)
+		nodesConfigPath, _ := cmd.Flags().GetString(nodesPathFlag)
+		types, _ := cmd.Flags().GetStringArray(typesFlag)
+
+		data, err := os.ReadFile(accountPath)
+		if err != nil {
+			return ioError(fmt.Errorf("couldn't read file: %w", err))
+		}
+		var file accountFile
+		if err = yaml.Unmarshal(data, &file); err != nil {
+			return invalidInputf("the file structure is wrong: %v", err)
+		}
+
+		var nodesConfig *nodeconf.Configuration
+		if nodesConfigPath != "" {
+			conf, err := readNodesConfig(nodesConfigPath)
+			if err != nil {
+				return err
+			}
+			nodesConfig = &conf
+		} else if file.Network != nil {
+			nodesConfig = &nodeconf.Configuration{NetworkId: file.Network.NetworkId, Nodes: file.Network.Nodes}
+		}
+
+		var expectedTypes []nodeconf.NodeType
+		if len(types) > 0 {
+			if expectedTypes, err = parseNodeTypes(types); err != nil {
+				return err
+			}
+		}
+
+		keys, err := newKeyProvider(cmd)
+		if err != nil {
+			return err
+		}
+
+		res := verifyResult{PeerId: file.Account.PeerId, Checks: checkAccount(keys, file.Account, nodesConfig, expectedTypes)}
+		failed := 0
+		for _, c := range res.Checks {
+			if c.Err != nil {
+				failed++
+			}
+		}
+		res.Valid = failed == 0
+
+		report(res, func() {
+			for _, c := range res.Checks {
+				fmt.Println(c)
+			}
+			if res.Valid {
+				fmt.Printf("Account %s is valid\n", file.Account.PeerId)
+			}
+		})
+		if !res.Valid {
+			return checkFailed("account %s is invalid: %d check(s) failed", file.Account.PeerId, failed)
+		}
+		return nil
+	},
+}
+
+// checkAccount checks the keys of the account against each other, the node list and the expected types.
+// If expectedTypes is empty, the types of the node list are used for the signing key rule.
+// The keys are resolved with the key provider, so an account with key references can be checked too
+func checkAccount(keys builder.KeyProvider, account accountservice.Config, nodesConfig *nodeconf.Configuration, expectedTypes []nodeconf.NodeType) (checks []accountCheck) {
+	peerKey, err := keys.PublicKey(account.PeerKey)
+	checks = append(checks, accountCheck{Name: "peer key decodes", Err: err})
+
+	signKey, err := keys.PublicKey(account.SigningKey)
+	checks = append(checks, accountCheck{Name: "signing key decodes", Err: err})
+
+	peerIdCheck := accountCheck{Name: "peer id matches the peer key"}
+	if peerKey == nil {
+		peerIdCheck.Skipped = "no peer key"
+	} else if peerId := peerKey.PeerId(); peerId != account.PeerId {
+		peerIdCheck.Err = fmt.Errorf("peer key belongs to %s, not %s", peerId, account.PeerId)
+	}
+	checks = append(checks, peerIdCheck)
+
+	var node *nodeconf.Node
+	if nodesConfig != nil {
+		for i := range nodesConfig.Nodes {
+			if nodesConfig.Nodes[i].PeerId == account.PeerId {
+				node = &nodesConfig.Nodes[i]
+				break
+			}
+		}
+	}
+
+	memberCheck := accountCheck{Name: "account is in the node list"}
+	switch {
+	case nodesConfig == nil:
+		memberCheck.Skipped = "no node list"
+	case node == nil:
+		memberCheck.Err = fmt.Errorf("peer id %s is not found", account.PeerId)
+	}
+	checks = append(checks, memberCheck)
+
+	if len(expectedTypes) > 0 {
+		typesCheck := accountCheck{Name: fmt.Sprintf("node has types %v", expectedTypes)}
+		switch {
+		case node == nil:
+			typesCheck.Skipped = "the node is not in the node list"
+		case !sameTypes(node.Types, expectedTypes):
+			typesCheck.Err = fmt.Errorf("node has types %v", node.Types)
+		}
+		checks = append(checks, typesCheck)
+	}
+
+	types := expectedTypes
+	if len(types) == 0 && node != nil {
+		types = node.Types
+	}
+	checks = append(checks, checkSigningKey(peerKey, signKey, types, nodesConfig))
+	return
+}
+
+// checkSigningKey checks the signing key is the network key for coordinators and the peer key for other nodes
+func checkSigningKey(peerKey, signKey crypto.PubKey, types []nodeconf.NodeType, nodesConfig *nodeconf.Configuration) (c accountCheck) {
+	if len(types) == 0 {
+		c.Name = "signing key rule"
+		c.Skipped = "the node types are unknown"
+		return
+	}
+	if signKey == nil || peerKey == nil {
+		c.Name = "signing key rule"
+		c.Skipped = "the keys can't be decoded"
+		return
+	}
+
+	if !gen.UsesNetworkKey(types) {
+		c.Name = "signing key is the peer key"
+		if !signKey.Equals(peerKey) {
+			c.Err = fmt.Errorf("signing key differs from the peer key")
+		}
+		return
+	}
+
+	c.Name = "signing key is the network key"
+	switch {
+	case nodesConfig == nil || nodesConfig.NetworkId == "":
+		c.Skipped = "the network id is unknown"
+	case signKey.Network() != nodesConfig.NetworkId:
+		c.Err = fmt.Errorf("signing key belongs to network %s, not %s", signKey.Network(), nodesConfig.NetworkId)
+	}
+	return
+}
+
+func sameTypes(actual, expected []nodeconf.NodeType) bool {
+	if len(actual) != len(expected) {
+		return false
+	}
+	for _, t := range expected {
+		if !slices.Contains(actual, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	verifyAccount.Flags().String(accountPathFlag, "account.yml", "Path to the account yaml or a complete node config")
+	verifyAccount.Flags().String(nodesPathFlag, "", "Path to nodes yaml [optional, the network of the account file is used by default]")
+	verifyAccount.Flags().StringArray(typesFlag, []string{}, "Expected node types [optional], "+typesUsage)
+	addKeyProviderFlag(verifyAccount)
+}
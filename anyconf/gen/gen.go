@@ -1,36 +1,90 @@
 package gen
 
 import (
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
 	"github.com/anyproto/any-sync/accountservice"
 	"github.com/anyproto/any-sync/nodeconf"
 	"github.com/anyproto/any-sync/util/crypto"
 	"golang.org/x/exp/slices"
 )
 
+// NodeConfigInfo is the complete config of a generated node
 type NodeConfigInfo struct {
-	Config  any
-	Account accountservice.Config
-	Nodes   nodeconf.Configuration
+	Config any
+	// General is the part of Config common for all node types
+	General  builder.GeneralNodeConfig
+	Account  accountservice.Config
+	Nodes    nodeconf.Configuration
+	NodeType nodeconf.NodeType
 }
 
+// NodeParameters describe a node to generate.
+// Address is host[:port] of the yamux transport, the quic port is the yamux one plus 1000.
+// DebugAddress is the API server address of tree nodes and the metric address of the other nodes.
+// DBPath is the directory the node keeps its data in.
+// PeerKey is the key of the node, a new one is generated with the key provider if it is nil
 type NodeParameters struct {
 	DebugAddress, Address, DBPath string
 	NodeType                      nodeconf.NodeType
+	PeerKey                       crypto.PrivKey
 }
 
-func GenNodeConfig(addresses []string, types []nodeconf.NodeType, netKey crypto.PrivKey) (nc nodeconf.Node, ac accountservice.Config, err error) {
+// NodeTypes are all the node types nodeconf knows about
+var NodeTypes = []nodeconf.NodeType{
+	nodeconf.NodeTypeTree,
+	nodeconf.NodeTypeFile,
+	nodeconf.NodeTypeConsensus,
+	nodeconf.NodeTypeCoordinator,
+	nodeconf.NodeTypeNamingNode,
+	nodeconf.NodeTypePaymentProcessingNode,
+}
 
-	signKey, _, err := crypto.GenerateRandomEd25519KeyPair()
-	if err != nil {
-		return
+// UsesNetworkKey reports whether the node signs with the network key instead of its peer key.
+// Only coordinators do, every other node type signs with its own peer key
+func UsesNetworkKey(types []nodeconf.NodeType) bool {
+	return slices.Contains(types, nodeconf.NodeTypeCoordinator)
+}
+
+// ValidateTypes checks that the types are known and can be combined in one node.
+// A coordinator can't share the node with other types, as it signs with the network key
+func ValidateTypes(types []nodeconf.NodeType) error {
+	if len(types) == 0 {
+		return fmt.Errorf("node should have at least one type")
+	}
+	for _, nodeType := range types {
+		if !slices.Contains(NodeTypes, nodeType) {
+			return fmt.Errorf("wrong node 'type' parameter: '%s'", nodeType)
+		}
+	}
+	if UsesNetworkKey(types) && len(types) > 1 {
+		return fmt.Errorf("'%s' type can't be combined with other types", nodeconf.NodeTypeCoordinator)
 	}
+	return nil
+}
 
-	encPeerSignKey, err := crypto.EncodeKeyToString(signKey) //encSignKey
+// GenNodeConfig generates the keys of a new node with the key provider, nil is the in-process one.
+// The signing key follows UsesNetworkKey: it is the network key for coordinators (empty if netKey is zero)
+// and the peer key otherwise
+func GenNodeConfig(keys builder.KeyProvider, addresses []string, types []nodeconf.NodeType, netKey builder.Key) (nc nodeconf.Node, ac accountservice.Config, err error) {
+	if keys == nil {
+		keys = builder.LocalKeyProvider{}
+	}
+	peerKey, err := keys.GenerateKey()
 	if err != nil {
 		return
 	}
 
-	peerID := signKey.GetPublic().PeerId()
+	return NodeConfigFromKey(peerKey, addresses, types, netKey)
+}
+
+// NodeConfigFromKey is GenNodeConfig with the given peer key, e.g. the one derived with DeriveKey
+func NodeConfigFromKey(peerKey builder.Key, addresses []string, types []nodeconf.NodeType, netKey builder.Key) (nc nodeconf.Node, ac accountservice.Config, err error) {
+	peerID := peerKey.PubKey.PeerId()
 
 	nc = nodeconf.Node{
 		PeerId:    peerID,
@@ -38,19 +92,15 @@ func GenNodeConfig(addresses []string, types []nodeconf.NodeType, netKey crypto.
 		Types:     types,
 	}
 
-	encSignKey := encPeerSignKey
-	if slices.Contains(types, nodeconf.NodeTypeCoordinator) {
-		if netKey != nil {
-			encSignKey, _ = crypto.EncodeKeyToString(netKey)
-		} else {
-			encSignKey = ""
-		}
+	signKey := peerKey.Ref
+	if UsesNetworkKey(types) {
+		signKey = netKey.Ref
 	}
 
 	ac = accountservice.Config{
 		PeerId:     peerID,
-		PeerKey:    encPeerSignKey,
-		SigningKey: encSignKey,
+		PeerKey:    peerKey.Ref,
+		SigningKey: signKey,
 	}
 
 	return
@@ -58,7 +108,7 @@ func GenNodeConfig(addresses []string, types []nodeconf.NodeType, netKey crypto.
 
 func GenerateNodesConfigs(nodes []NodeParameters) (nodesConf []nodeconf.Node, accounts []accountservice.Config, err error) {
 	for _, node := range nodes {
-		commonConfig, accountConfig, err := GenNodeConfig([]string{node.Address}, []nodeconf.NodeType{node.NodeType}, nil)
+		commonConfig, accountConfig, err := GenNodeConfig(nil, []string{node.Address}, []nodeconf.NodeType{node.NodeType}, builder.Key{})
 
 		if err != nil {
 			panic(err)
@@ -71,160 +121,212 @@ func GenerateNodesConfigs(nodes []NodeParameters) (nodesConf []nodeconf.Node, ac
 	return
 }
 
-/*
-
+const (
+	defaultHost    = "127.0.0.1"
+	quicPortOffset = 1000
+	// the metric and API server ports are derived from the yamux port, so the nodes of one host don't collide
+	metricPortOffset = 2000
+	apiPortOffset    = 3000
+	debugHost        = "0.0.0.0"
+	defaultDBDir     = "db"
+)
 
-func GenerateFullNodesConfigs(nodes []NodeParameters, additionalAccounts []nodeconf.Node) (fullNodesConfig []NodeConfigInfo, err error) {
-	nodesConf, accounts, err := GenerateNodesConfigs(nodes)
-	nodesConf = append(nodesConf, additionalAccounts...)
+// defaultPorts are the yamux ports of the nodes without a port in the address, every next node of the type gets the next port
+var defaultPorts = map[nodeconf.NodeType]int{
+	nodeconf.NodeTypeTree:                  4430,
+	nodeconf.NodeTypeConsensus:             4530,
+	nodeconf.NodeTypeFile:                  4730,
+	nodeconf.NodeTypeCoordinator:           4830,
+	nodeconf.NodeTypeNamingNode:            4930,
+	nodeconf.NodeTypePaymentProcessingNode: 4940,
+}
 
-	if err != nil {
-		panic(err)
+// GenerateFullNodesConfigs generates directly runnable configs of the nodes.
+// Coordinators sign with the network key, its public key is the network id. The nodes may have no coordinator,
+// e.g. the ones added to an existing network.
+// The nodes without a debug address or a data path get their own ones, see applyParameters.
+// The keys not given are generated with the key provider, nil is the in-process one
+func GenerateFullNodesConfigs(nodes []NodeParameters, netKey crypto.PrivKey, keys builder.KeyProvider) (fullNodesConfig []NodeConfigInfo, err error) {
+	opts := []builder.Option{builder.WithKeyProvider(keys)}
+	if netKey != nil {
+		opts = append(opts, builder.WithNetworkKey(netKey))
 	}
-
-	stream := net.StreamConfig{
-		TimeoutMilliseconds: 1000,
-		MaxMsgSizeMb:        256,
+	b, err := builder.New(opts...)
+	if err != nil {
+		return
 	}
 
-	for index, account := range accounts {
-		nodeConf := nodesConf[index]
-		debugAddress := nodes[index].DebugAddress
-		nodeType := nodes[index].NodeType
-		debugServer := net.Config{
-			Server: net.ServerConfig{ListenAddrs: []string{debugAddress}},
-			Stream: stream,
+	typeCounts := map[nodeconf.NodeType]int{}
+	ports := make([]int, len(nodes))
+	dbPaths := make([]string, len(nodes))
+	for i, node := range nodes {
+		if err = ValidateTypes([]nodeconf.NodeType{node.NodeType}); err != nil {
+			return
 		}
-		dbPath := nodes[index].DBPath
-		grpcServcer := net.Config{
-			Server: net.ServerConfig{ListenAddrs: nodeConf.Addresses},
-			Stream: stream,
+		var host string
+		if host, ports[i], err = splitAddress(node.Address, defaultPorts[node.NodeType]+typeCounts[node.NodeType]); err != nil {
+			return nil, err
 		}
-
-		var anyConf any
-
-		switch nodeType {
-		case nodeconf.NodeTypeCoordinator:
-			anyConf = coordinatorConf.Config{
-				Account:    account,
-				GrpcServer: grpcServcer,
-				Metric:     metric.Config{""},
-				Nodes:      nodesConf,
-				Mongo: db.Mongo{
-					Connect:          "mongodb://localhost:27017",
-					Database:         "coordinator_test",
-					SpacesCollection: "spaces",
-					LogCollection:    "log",
-				},
-				SpaceStatus: spacestatus.Config{RunSeconds: 20, DeletionPeriodDays: 0},
+		dbPaths[i] = path.Join(defaultDBDir, fmt.Sprintf("%s-%d", node.NodeType, typeCounts[node.NodeType]))
+		typeCounts[node.NodeType]++
+		listen := builder.WithListen(host, ports[i], ports[i]+quicPortOffset)
+
+		// the builder generates the accounts of the nodes without a peer key and signs coordinators with the network key
+		opts := []builder.NodeOption{listen}
+		if node.PeerKey != nil {
+			peerKey, err := builder.LocalKey(node.PeerKey)
+			if err != nil {
+				return nil, err
 			}
-		default:
-			anyConf = config.Config{
-				GrpcServer: grpcServcer,
-				Account:    account,
-				APIServer:  debugServer,
-				Nodes:      nodesConf,
-				Space: commonspace.Config{
-					GCTTL:      60,
-					SyncPeriod: 20,
-				},
-				Storage: nodestorage.Config{Path: dbPath},
-				Metric:  metric.Config{""},
-				Log: logger.Config{
-					Production:   false,
-					DefaultLevel: "",
-					NamedLevels:  make(map[string]string),
-				},
-				NodeSync: nodesync.Config{
-					SyncOnStart:       false,
-					PeriodicSyncHours: 0,
-				},
+			_, account, err := NodeConfigFromKey(peerKey, nil, []nodeconf.NodeType{node.NodeType}, builder.Key{})
+			if err != nil {
+				return nil, err
 			}
+			opts = append(opts, builder.WithAccount(account))
 		}
 
-		nodeInfo := NodeConfigInfo{
-			Config:         anyConf,
-			DebugApiServer: debugServer,
-			Account:        account,
-			Nodes:          nodesConf,
+		switch node.NodeType {
+		case nodeconf.NodeTypeCoordinator:
+			_, err = b.AddCoordinator(append(opts,
+				builder.WithMongo("mongodb://localhost:27017", "coordinator"),
+				builder.WithSpaceLimits(builder.SpaceLimits{SpaceMembersRead: 1000, SpaceMembersWrite: 1000, SharedSpacesLimit: 1000}),
+			)...)
+		case nodeconf.NodeTypeConsensus:
+			_, err = b.AddConsensus(append(opts,
+				builder.WithMongo("mongodb://localhost:27017/?w=majority", "consensus"),
+			)...)
+		case nodeconf.NodeTypeTree:
+			_, err = b.AddSyncNode(opts...)
+		case nodeconf.NodeTypeFile:
+			_, err = b.AddFileNode(append(opts,
+				builder.WithS3Store(builder.S3StoreConfig{
+					Endpoint:       "http://localhost:9000",
+					Bucket:         "minio-bucket",
+					IndexBucket:    "minio-bucket",
+					Region:         "us-east-1",
+					Profile:        "default",
+					ForcePathStyle: true,
+				}),
+				builder.WithRedis(builder.RedisConfig{URL: "redis://localhost:6379?dial_timeout=3&read_timeout=6s"}),
+				builder.WithDefaultLimit(1099511627776),
+			)...)
+		case nodeconf.NodeTypeNamingNode:
+			_, err = b.AddNamingNode(opts...)
+		case nodeconf.NodeTypePaymentProcessingNode:
+			_, err = b.AddPaymentProcessingNode(opts...)
+		}
+		if err != nil {
+			return nil, err
 		}
-
-		fullNodesConfig = append(fullNodesConfig, nodeInfo)
 	}
 
-	return
-}
-
-// Temporary here
-func GenerateClientConfig(nodesConfig []nodeconf.NodeConfig, address string, grpcPort, debugPort int) (cfg clconfig.Config, err error) {
-	encClientKey, _, err := encryptionkey.GenerateRandomRSAKeyPair(2048)
+	res, err := b.BuildPartial()
 	if err != nil {
-		panic(fmt.Sprintf("could not generate client encryption key: %s", err.Error()))
+		return
 	}
 
-	signClientKey, _, err := signingkey.GenerateRandomEd25519KeyPair()
-	if err != nil {
-		panic(fmt.Sprintf("could not generate client signing key: %s", err.Error()))
+	configs := map[string]any{}
+	for _, c := range res.Coordinators {
+		configs[c.Account.PeerId] = c
 	}
-
-	peerKey, _, err := signingkey.GenerateRandomEd25519KeyPair()
-	if err != nil {
-		return clconfig.Config{}, err
+	for _, c := range res.ConsensusNodes {
+		configs[c.Account.PeerId] = c
+	}
+	for _, c := range res.SyncNodes {
+		configs[c.Account.PeerId] = c
+	}
+	for _, c := range res.FileNodes {
+		configs[c.Account.PeerId] = c
+	}
+	for _, c := range res.NamingNodes {
+		configs[c.Account.PeerId] = c
+	}
+	for _, c := range res.PaymentNodes {
+		configs[c.Account.PeerId] = c
 	}
 
-	encEncKey, err := keys.EncodeKeyToString(encClientKey)
-	if err != nil {
-		return clconfig.Config{}, err
+	// the network list keeps the order of the nodes
+	for i, node := range res.Configuration.Nodes {
+		params := nodes[i]
+		if params.DBPath == "" {
+			params.DBPath = dbPaths[i]
+		}
+		config, general := applyParameters(configs[node.PeerId], params, ports[i])
+		fullNodesConfig = append(fullNodesConfig, NodeConfigInfo{
+			Config:   config,
+			General:  general,
+			Account:  general.Account,
+			Nodes:    res.Configuration,
+			NodeType: nodes[i].NodeType,
+		})
 	}
+	return
+}
 
-	encSignKey, err := keys.EncodeKeyToString(signClientKey)
-	if err != nil {
-		return clconfig.Config{}, err
+// GenerateClientConfig returns the network config clients (anytype-heart) are started with
+func GenerateClientConfig(nodesConfig nodeconf.Configuration) builder.HeartConfig {
+	return builder.NetworkFromConfiguration(nodesConfig).HeartConfig
+}
+
+// applyParameters sets the debug addresses and the data paths of the node config.
+// The metric address is the yamux port plus metricPortOffset unless the debug address sets it,
+// the API server of tree nodes is the debug address or the yamux port plus apiPortOffset
+func applyParameters(config any, params NodeParameters, yamuxPort int) (any, builder.GeneralNodeConfig) {
+	metricAddr := net.JoinHostPort(debugHost, strconv.Itoa(yamuxPort+metricPortOffset))
+	applyGeneral := func(general *builder.GeneralNodeConfig) {
+		general.Metric.Addr = metricAddr
+		general.NetworkStorePath = path.Join(params.DBPath, "networkStore")
 	}
 
-	encPeerKey, err := keys.EncodeKeyToString(peerKey)
-	if err != nil {
-		return clconfig.Config{}, err
+	switch c := config.(type) {
+	case builder.CoordinatorNodeConfig:
+		applyGeneral(&c.GeneralNodeConfig)
+		if params.DebugAddress != "" {
+			c.Metric.Addr = params.DebugAddress
+		}
+		return c, c.GeneralNodeConfig
+	case builder.ConsensusNodeConfig:
+		applyGeneral(&c.GeneralNodeConfig)
+		if params.DebugAddress != "" {
+			c.Metric.Addr = params.DebugAddress
+		}
+		return c, c.GeneralNodeConfig
+	case builder.SyncNodeConfig:
+		applyGeneral(&c.GeneralNodeConfig)
+		// the debug address of a tree node is its API server
+		c.ApiServer.ListenAddr = net.JoinHostPort(debugHost, strconv.Itoa(yamuxPort+apiPortOffset))
+		if params.DebugAddress != "" {
+			c.ApiServer.ListenAddr = params.DebugAddress
+		}
+		c.Storage.Path = path.Join(params.DBPath, "storage")
+		c.Storage.AnyStorePath = path.Join(params.DBPath, "anyStorage")
+		return c, c.GeneralNodeConfig
+	case builder.FileNodeConfig:
+		applyGeneral(&c.GeneralNodeConfig)
+		if params.DebugAddress != "" {
+			c.Metric.Addr = params.DebugAddress
+		}
+		return c, c.GeneralNodeConfig
+	case builder.GeneralNodeConfig:
+		applyGeneral(&c)
+		if params.DebugAddress != "" {
+			c.Metric.Addr = params.DebugAddress
+		}
+		return c, c
 	}
+	return config, builder.GeneralNodeConfig{}
+}
 
-	peerID, err := peer.IdFromSigningPubKey(peerKey.GetPublic())
-	if err != nil {
-		return clconfig.Config{}, err
-	}
-
-	debugAddress := fmt.Sprintf("%s:%d", address, debugPort)
-	grpcAddress := fmt.Sprintf("%s:%d", address, grpcPort)
-	return clconfig.Config{
-		GrpcServer: net.Config{
-			Server: net.ServerConfig{
-				ListenAddrs: []string{grpcAddress},
-			},
-			Stream: net.StreamConfig{
-				TimeoutMilliseconds: 1000,
-				MaxMsgSizeMb:        256,
-			},
-		},
-		Storage: badgerprovider.Config{Path: fmt.Sprintf("db/client/%d/data", debugPort)},
-		Account: commonaccount.Config{
-			PeerId:        peerID.String(),
-			PeerKey:       encPeerKey,
-			SigningKey:    encSignKey,
-			EncryptionKey: encEncKey,
-		},
-		APIServer: net.Config{
-			Server: net.ServerConfig{
-				ListenAddrs: []string{debugAddress},
-			},
-			Stream: net.StreamConfig{
-				TimeoutMilliseconds: 1000,
-				MaxMsgSizeMb:        256,
-			},
-		},
-		Nodes: nodesConfig,
-		Space: commonspace.Config{
-			GCTTL:      60,
-			SyncPeriod: 20,
-		},
-	}, nil
+// splitAddress parses host[:port], the default port is used if the address has none
+func splitAddress(address string, defaultPort int) (host string, port int, err error) {
+	host, port = address, defaultPort
+	if address == "" {
+		host = defaultHost
+	} else if h, p, err := net.SplitHostPort(address); err == nil {
+		host = h
+		if port, err = strconv.Atoi(p); err != nil {
+			return "", 0, fmt.Errorf("wrong port in address '%s'", address)
+		}
+	}
+	return host, port, nil
 }
-*/
@@ -0,0 +1,17 @@
+package gen
+
+import (
+	"fmt"
+
+	"github.com/anyproto/any-sync/util/crypto"
+)
+
+// DeriveKey derives the key of the index from the BIP39 mnemonic with SLIP-0010 (m/44'/2046'/index'/0').
+// It is the identity any-sync-signing shows for the same mnemonic and index, so the key can be recovered from the mnemonic
+func DeriveKey(mnemonic crypto.Mnemonic, index uint32) (crypto.PrivKey, error) {
+	res, err := mnemonic.DeriveKeys(index)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive the key %d: %w", index, err)
+	}
+	return res.Identity, nil
+}
@@ -0,0 +1,134 @@
+// Package nodelist reads and writes the node lists of all tools of the repo and normalizes them to nodeconf
+package nodelist
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/anyproto/any-sync-tools/any-sync-network/builder"
+	"github.com/anyproto/any-sync/nodeconf"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a shape of the node list
+type Format string
+
+const (
+	// FormatNodeconf is nodeconf.Configuration, used by anyconf, any-sync-acl-cli and the coordinator
+	FormatNodeconf Format = "nodeconf"
+	// FormatNetwork is the network section of any-sync-network node configs
+	FormatNetwork Format = "network"
+	// FormatClient is the client.yml of any-sync-network and anyconf, without the configuration id
+	FormatClient Format = "client"
+	// FormatNetcheck is the -c file of any-sync-netcheck
+	FormatNetcheck Format = "netcheck"
+	// FormatNodeConfig is a complete node config with the network section, it can only be read
+	FormatNodeConfig Format = "node-config"
+)
+
+// Formats lists the formats that can be written
+var Formats = []Format{FormatNodeconf, FormatNetwork, FormatClient, FormatNetcheck}
+
+var ErrUnknownFormat = errors.New("unknown node list format")
+
+// ConfigFile is the node list read by any-sync-netcheck
+type ConfigFile struct {
+	Id        string `yaml:"id"`
+	NetworkId string `yaml:"networkId"`
+	Nodes     []Node `yaml:"nodes"`
+}
+
+type Node struct {
+	Addresses []string `yaml:"addresses"`
+	PeerId    string   `yaml:"peerId"`
+	Types     []string `yaml:"types"`
+}
+
+// shape holds the keys used to tell the formats apart
+type shape struct {
+	Id           *string    `yaml:"id"`
+	CreationTime *time.Time `yaml:"creationTime"`
+	Nodes        yaml.Node  `yaml:"nodes"`
+	Network      yaml.Node  `yaml:"network"`
+}
+
+// Load reads the node list from the file in any format
+func Load(path string) (conf nodeconf.Configuration, format Format, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return conf, "", fmt.Errorf("couldn't read file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse detects the format of the node list and converts it to nodeconf.
+// The netcheck format can't be told apart from the network one and is reported as network
+func Parse(data []byte) (conf nodeconf.Configuration, format Format, err error) {
+	var s shape
+	if err = yaml.Unmarshal(data, &s); err != nil {
+		return conf, "", fmt.Errorf("the file structure is wrong: %w", err)
+	}
+
+	switch {
+	case !s.Network.IsZero() && s.Nodes.IsZero():
+		var network builder.Network
+		if err = s.Network.Decode(&network); err != nil {
+			return conf, "", fmt.Errorf("the network section is wrong: %w", err)
+		}
+		return network.Configuration(time.Time{}), FormatNodeConfig, nil
+	case s.Nodes.IsZero():
+		return conf, "", ErrUnknownFormat
+	case s.CreationTime != nil:
+		format = FormatNodeconf
+	case s.Id != nil:
+		format = FormatNetwork
+	default:
+		format = FormatClient
+	}
+
+	if err = yaml.Unmarshal(data, &conf); err != nil {
+		return conf, "", fmt.Errorf("the file structure is wrong: %w", err)
+	}
+	return conf, format, nil
+}
+
+// Marshal writes the node list in the format
+func Marshal(conf nodeconf.Configuration, format Format) ([]byte, error) {
+	switch format {
+	case FormatNodeconf:
+		return yaml.Marshal(conf)
+	case FormatNetwork:
+		return yaml.Marshal(builder.NetworkFromConfiguration(conf))
+	case FormatClient:
+		return yaml.Marshal(builder.NetworkFromConfiguration(conf).HeartConfig)
+	case FormatNetcheck:
+		return yaml.Marshal(netcheckConfig(conf))
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+}
+
+// Save writes the node list to the file in the format
+func Save(path string, conf nodeconf.Configuration, format Format) error {
+	data, err := Marshal(conf, format)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, data, os.ModePerm); err != nil {
+		return fmt.Errorf("could not write the config to file: %w", err)
+	}
+	return nil
+}
+
+func netcheckConfig(conf nodeconf.Configuration) ConfigFile {
+	file := ConfigFile{Id: conf.Id, NetworkId: conf.NetworkId, Nodes: make([]Node, 0, len(conf.Nodes))}
+	for _, node := range conf.Nodes {
+		types := make([]string, 0, len(node.Types))
+		for _, t := range node.Types {
+			types = append(types, string(t))
+		}
+		file.Nodes = append(file.Nodes, Node{Addresses: node.Addresses, PeerId: node.PeerId, Types: types})
+	}
+	return file
+}
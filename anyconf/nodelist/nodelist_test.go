@@ -0,0 +1,101 @@
+package nodelist
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConf = nodeconf.Configuration{
+	Id:           "6ad53695686c8279f10e5495",
+	NetworkId:    "N6zrTtsMAz3UQPEGUzHNA6GHGhdDPwwDikBPKgmuNetoktDT",
+	CreationTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	Nodes: []nodeconf.Node{
+		{PeerId: "peer1", Addresses: []string{"127.0.0.1:4830", "quic://127.0.0.1:5830"}, Types: []nodeconf.NodeType{nodeconf.NodeTypeCoordinator}},
+		{PeerId: "peer2", Addresses: []string{"127.0.0.1:4430"}, Types: []nodeconf.NodeType{nodeconf.NodeTypeTree}},
+	},
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		data   string
+		format Format
+		id     string
+	}{
+		{
+			name:   "nodeconf",
+			data:   "id: conf1\nnetworkId: net1\nnodes:\n  - peerId: peer1\n    addresses: [127.0.0.1:4830]\n    types: [coordinator]\ncreationTime: 2026-01-02T03:04:05Z\n",
+			format: FormatNodeconf,
+			id:     "conf1",
+		},
+		{
+			name:   "network",
+			data:   "id: conf1\nnetworkId: net1\nnodes:\n  - peerId: peer1\n    addresses: [127.0.0.1:4830]\n    types: [coordinator]\n",
+			format: FormatNetwork,
+			id:     "conf1",
+		},
+		{
+			name:   "client",
+			data:   "networkId: net1\nnodes:\n  - peerId: peer1\n    addresses: [127.0.0.1:4830]\n    types: [coordinator]\n",
+			format: FormatClient,
+		},
+		{
+			name:   "node config",
+			data:   "account:\n  peerId: peer1\nnetwork:\n  id: conf1\n  networkId: net1\n  nodes:\n    - peerId: peer1\n      addresses: [127.0.0.1:4830]\n      types: [coordinator]\n",
+			format: FormatNodeConfig,
+			id:     "conf1",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, format, err := Parse([]byte(tc.data))
+			require.NoError(t, err)
+			assert.Equal(t, tc.format, format)
+			assert.Equal(t, tc.id, conf.Id)
+			assert.Equal(t, "net1", conf.NetworkId)
+			require.Len(t, conf.Nodes, 1)
+			assert.Equal(t, "peer1", conf.Nodes[0].PeerId)
+			assert.Equal(t, []nodeconf.NodeType{nodeconf.NodeTypeCoordinator}, conf.Nodes[0].Types)
+		})
+	}
+
+	_, _, err := Parse([]byte("account:\n  peerId: peer1\n"))
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+	_, _, err = Parse([]byte("nodes: ["))
+	assert.Error(t, err)
+}
+
+func TestMarshal(t *testing.T) {
+	for _, tc := range []struct {
+		format   Format
+		detected Format
+		keepsId  bool
+	}{
+		{FormatNodeconf, FormatNodeconf, true},
+		{FormatNetwork, FormatNetwork, true},
+		{FormatClient, FormatClient, false},
+		// the netcheck format has the same keys as the network one
+		{FormatNetcheck, FormatNetwork, true},
+	} {
+		t.Run(string(tc.format), func(t *testing.T) {
+			data, err := Marshal(testConf, tc.format)
+			require.NoError(t, err)
+			conf, format, err := Parse(data)
+			require.NoError(t, err)
+			assert.Equal(t, tc.detected, format)
+			assert.Equal(t, testConf.NetworkId, conf.NetworkId)
+			assert.Equal(t, testConf.Nodes, conf.Nodes)
+			if tc.keepsId {
+				assert.Equal(t, testConf.Id, conf.Id)
+			} else {
+				assert.Empty(t, conf.Id)
+			}
+		})
+	}
+
+	_, err := Marshal(testConf, FormatNodeConfig)
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
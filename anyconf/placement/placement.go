@@ -0,0 +1,264 @@
+// Package placement reproduces how nodeconf places spaces on tree nodes
+package placement
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/anyproto/go-chash"
+)
+
+// Placement is the consistent hash of the tree nodes built the same way nodeconf does it
+type Placement struct {
+	conf      nodeconf.Configuration
+	chash     chash.CHash
+	treePeers []string
+}
+
+// New builds the placement of the configuration
+func New(conf nodeconf.Configuration) (*Placement, error) {
+	ch, err := chash.New(chash.Config{
+		PartitionCount:    nodeconf.PartitionCount,
+		ReplicationFactor: nodeconf.ReplicationFactor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := &Placement{conf: conf, chash: ch}
+	var members []chash.Member
+	for _, n := range conf.Nodes {
+		if n.HasType(nodeconf.NodeTypeTree) {
+			members = append(members, n)
+			p.treePeers = append(p.treePeers, n.PeerId)
+		}
+	}
+	if err = ch.AddMembers(members...); err != nil {
+		return nil, fmt.Errorf("can't add tree nodes to the consistent hash: %w", err)
+	}
+	return p, nil
+}
+
+// TreePeers returns the peer ids of the tree nodes
+func (p *Placement) TreePeers() []string {
+	return p.treePeers
+}
+
+// PartitionCount returns the number of partitions
+func (p *Placement) PartitionCount() int {
+	return p.chash.PartitionCount()
+}
+
+// Partition returns the partition of the space
+func (p *Placement) Partition(spaceId string) int {
+	return p.chash.GetPartition(nodeconf.ReplKey(spaceId))
+}
+
+// SpacePeers returns the peer ids of the tree nodes responsible for the space
+func (p *Placement) SpacePeers(spaceId string) []string {
+	return memberIds(p.chash.GetMembers(nodeconf.ReplKey(spaceId)))
+}
+
+// PartitionPeers returns the peer ids of the tree nodes responsible for the partition
+func (p *Placement) PartitionPeers(part int) ([]string, error) {
+	members, err := p.chash.GetPartitionMembers(part)
+	if err != nil {
+		return nil, err
+	}
+	return memberIds(members), nil
+}
+
+// Load returns the number of the given spaces every tree node is responsible for
+func (p *Placement) Load(spaceIds []string) map[string]int {
+	load := make(map[string]int, len(p.treePeers))
+	for _, peerId := range p.treePeers {
+		load[peerId] = 0
+	}
+	for _, spaceId := range spaceIds {
+		for _, peerId := range p.SpacePeers(spaceId) {
+			load[peerId]++
+		}
+	}
+	return load
+}
+
+func memberIds(members []chash.Member) []string {
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.Id())
+	}
+	return ids
+}
+
+// Change describes how the responsible tree nodes of a partition or a space change between two placements
+type Change struct {
+	Gained []string `json:"gained,omitempty"`
+	Lost   []string `json:"lost,omitempty"`
+}
+
+// Changed reports whether the responsible node set changes
+func (c Change) Changed() bool {
+	return len(c.Gained) > 0 || len(c.Lost) > 0
+}
+
+func newChange(oldPeers, newPeers []string) (c Change) {
+	oldSet := make(map[string]bool, len(oldPeers))
+	for _, peerId := range oldPeers {
+		oldSet[peerId] = true
+	}
+	newSet := make(map[string]bool, len(newPeers))
+	for _, peerId := range newPeers {
+		newSet[peerId] = true
+		if !oldSet[peerId] {
+			c.Gained = append(c.Gained, peerId)
+		}
+	}
+	for _, peerId := range oldPeers {
+		if !newSet[peerId] {
+			c.Lost = append(c.Lost, peerId)
+		}
+	}
+	return
+}
+
+// SpaceChange returns the tree nodes the space gains and loses when moving from the old placement to the new one
+func SpaceChange(oldP, newP *Placement, spaceId string) Change {
+	return newChange(oldP.SpacePeers(spaceId), newP.SpacePeers(spaceId))
+}
+
+// Rebalance describes the partitions moving between two placements
+type Rebalance struct {
+	Partitions        int `json:"partitions"`
+	ChangedPartitions int `json:"changedPartitions"`
+	// MovedReplicas is the number of partition replicas new tree nodes have to receive
+	MovedReplicas int `json:"movedReplicas"`
+}
+
+// ChangedFraction returns the fraction of partitions whose responsible node set changes
+func (r Rebalance) ChangedFraction() float64 {
+	if r.Partitions == 0 {
+		return 0
+	}
+	return float64(r.ChangedPartitions) / float64(r.Partitions)
+}
+
+// Diff compares every partition of the old and the new placement
+func Diff(oldP, newP *Placement) (r Rebalance, err error) {
+	r.Partitions = oldP.PartitionCount()
+	for part := 0; part < r.Partitions; part++ {
+		oldPeers, err := oldP.PartitionPeers(part)
+		if err != nil {
+			return r, err
+		}
+		newPeers, err := newP.PartitionPeers(part)
+		if err != nil {
+			return r, err
+		}
+		c := newChange(oldPeers, newPeers)
+		if c.Changed() {
+			r.ChangedPartitions++
+		}
+		r.MovedReplicas += len(c.Gained)
+	}
+	return
+}
+
+// Replication describes how many replicas the spaces get
+type Replication struct {
+	TreeNodes         int `json:"treeNodes"`
+	ReplicationFactor int `json:"replicationFactor"`
+	// Partitions is the number of partitions by the number of their replicas
+	Partitions map[int]int `json:"partitions"`
+	// PeerPartitions is the number of partitions every tree node is responsible for
+	PeerPartitions map[string]int `json:"peerPartitions"`
+}
+
+// Replication checks every partition of the hash
+func (p *Placement) Replication() (r Replication, err error) {
+	r = Replication{
+		TreeNodes:         len(p.treePeers),
+		ReplicationFactor: nodeconf.ReplicationFactor,
+		Partitions:        map[int]int{},
+		PeerPartitions:    map[string]int{},
+	}
+	for _, peerId := range p.treePeers {
+		r.PeerPartitions[peerId] = 0
+	}
+	for part := 0; part < p.chash.PartitionCount(); part++ {
+		peers, err := p.PartitionPeers(part)
+		if err != nil {
+			return r, err
+		}
+		r.Partitions[len(peers)]++
+		for _, peerId := range peers {
+			r.PeerPartitions[peerId]++
+		}
+	}
+	return
+}
+
+// Full reports whether every space is stored on the replication factor number of tree nodes
+func (r Replication) Full() bool {
+	for replicas := range r.Partitions {
+		if replicas < r.ReplicationFactor {
+			return false
+		}
+	}
+	return r.TreeNodes > 0
+}
+
+// MinReplicas returns the lowest number of replicas a space gets
+func (r Replication) MinReplicas() int {
+	res := -1
+	for replicas := range r.Partitions {
+		if res == -1 || replicas < res {
+			res = replicas
+		}
+	}
+	if res == -1 {
+		return 0
+	}
+	return res
+}
+
+// Lines returns a human-readable report
+func (r Replication) Lines() []string {
+	lines := []string{fmt.Sprintf("Tree nodes: %d, replication factor: %d", r.TreeNodes, r.ReplicationFactor)}
+
+	replicaCounts := make([]int, 0, len(r.Partitions))
+	for replicas := range r.Partitions {
+		replicaCounts = append(replicaCounts, replicas)
+	}
+	sort.Ints(replicaCounts)
+	for _, replicas := range replicaCounts {
+		lines = append(lines, fmt.Sprintf("  %d of %d partitions: each space is stored on %d replica(s)", r.Partitions[replicas], r.partitionsTotal(), replicas))
+	}
+
+	peerIds := make([]string, 0, len(r.PeerPartitions))
+	for peerId := range r.PeerPartitions {
+		peerIds = append(peerIds, peerId)
+	}
+	sort.Strings(peerIds)
+	for _, peerId := range peerIds {
+		lines = append(lines, fmt.Sprintf("  %s: %d partitions", peerId, r.PeerPartitions[peerId]))
+	}
+	return lines
+}
+
+// Warning returns a description of the replication problem or an empty string
+func (r Replication) Warning() string {
+	switch {
+	case r.TreeNodes == 0:
+		return "the network has no tree nodes, spaces can't be stored"
+	case !r.Full():
+		return fmt.Sprintf("the network has %d tree node(s), spaces will be stored on %d replica(s) instead of %d", r.TreeNodes, r.MinReplicas(), r.ReplicationFactor)
+	}
+	return ""
+}
+
+func (r Replication) partitionsTotal() (total int) {
+	for _, count := range r.Partitions {
+		total += count
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package placement
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/anyproto/any-sync/nodeconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConf(treeNodes int) nodeconf.Configuration {
+	conf := nodeconf.Configuration{Nodes: []nodeconf.Node{
+		{PeerId: "coordinator", Types: []nodeconf.NodeType{nodeconf.NodeTypeCoordinator}},
+	}}
+	for i := 0; i < treeNodes; i++ {
+		conf.Nodes = append(conf.Nodes, nodeconf.Node{PeerId: fmt.Sprintf("tree%d", i), Types: []nodeconf.NodeType{nodeconf.NodeTypeTree}})
+	}
+	return conf
+}
+
+func TestPlacement_Replication(t *testing.T) {
+	for _, tc := range []struct {
+		treeNodes   int
+		full        bool
+		minReplicas int
+		warning     string
+	}{
+		{0, false, 0, "the network has no tree nodes, spaces can't be stored"},
+		{1, false, 1, "the network has 1 tree node(s), spaces will be stored on 1 replica(s) instead of 3"},
+		{2, false, 2, "the network has 2 tree node(s), spaces will be stored on 2 replica(s) instead of 3"},
+		{3, true, 3, ""},
+		{5, true, 3, ""},
+	} {
+		t.Run(fmt.Sprintf("%d tree nodes", tc.treeNodes), func(t *testing.T) {
+			p, err := New(testConf(tc.treeNodes))
+			require.NoError(t, err)
+			assert.Len(t, p.TreePeers(), tc.treeNodes)
+
+			r, err := p.Replication()
+			require.NoError(t, err)
+			assert.Equal(t, tc.full, r.Full())
+			assert.Equal(t, tc.minReplicas, r.MinReplicas())
+			assert.Equal(t, tc.warning, r.Warning())
+			assert.Equal(t, p.PartitionCount(), r.partitionsTotal())
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	oldP, err := New(testConf(3))
+	require.NoError(t, err)
+
+	same, err := Diff(oldP, oldP)
+	require.NoError(t, err)
+	assert.Equal(t, 0, same.ChangedPartitions)
+	assert.Equal(t, 0.0, same.ChangedFraction())
+
+	newP, err := New(testConf(4))
+	require.NoError(t, err)
+	r, err := Diff(oldP, newP)
+	require.NoError(t, err)
+	assert.Equal(t, oldP.PartitionCount(), r.Partitions)
+	assert.Greater(t, r.ChangedPartitions, 0)
+	// the new node only takes replicas over, every changed partition moves one replica to it
+	assert.Equal(t, r.ChangedPartitions, r.MovedReplicas)
+	replication, err := newP.Replication()
+	require.NoError(t, err)
+	assert.Equal(t, r.MovedReplicas, replication.PeerPartitions["tree3"])
+}
+
+func TestNewChange(t *testing.T) {
+	c := newChange([]string{"a", "b", "c"}, []string{"b", "c", "d"})
+	assert.Equal(t, Change{Gained: []string{"d"}, Lost: []string{"a"}}, c)
+	assert.True(t, c.Changed())
+	assert.False(t, newChange([]string{"a", "b"}, []string{"b", "a"}).Changed())
+}